@@ -0,0 +1,309 @@
+// abilities.go
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Ability effects a troop template can declare
+const (
+	EffectHealLowest = "heal_lowest" // heal the owner's weakest standing tower by amount
+	EffectShield     = "shield"      // give every standing tower of the owner an amount-HP shield
+	EffectManaDrain  = "mana_drain"  // remove amount mana from the opponent
+	EffectSplash     = "splash"      // hit the other standing enemy towers for ratio × the damage dealt
+	EffectPierceKing = "pierce_king" // hit the enemy King Tower for ratio × the damage dealt, even behind guards
+	EffectDOT        = "dot"         // burn the target for amount damage per second for duration seconds
+)
+
+// When an effect resolves
+const (
+	onDeploy = "deploy" // when the troop is played, before it attacks
+	onHit    = "hit"    // after the troop damages its target
+)
+
+// Ability is one effect of a troop, with its parameters
+type Ability struct {
+	Effect   string  `json:"effect"`
+	Amount   float64 `json:"amount,omitempty"`
+	Ratio    float64 `json:"ratio,omitempty"`
+	Duration int     `json:"duration,omitempty"` // seconds
+}
+
+// abilityContext is what an effect needs to know about the troop that triggered it
+type abilityContext struct {
+	playerNum    int
+	troop        *Troop
+	attacker     *PlayerData
+	defender     *PlayerData
+	attackerName string
+	defenderName string
+	target       *Tower  // the attacked tower; nil on deploy
+	damage       float64 // damage dealt to target
+}
+
+// abilityEffect is the engine side of an effect: when it fires, how its
+// parameters are checked and what it does
+type abilityEffect struct {
+	trigger  string
+	validate func(a Ability) error
+	resolve  func(m *Match, ctx *abilityContext, a Ability)
+}
+
+// abilityEffects maps effect names to their implementations. Adding an entry
+// here is all a new effect needs; troops only reference it from the templates.
+var abilityEffects = map[string]abilityEffect{
+	EffectHealLowest: {onDeploy, needAmount, (*Match).resolveHealLowest},
+	EffectShield:     {onDeploy, needAmount, (*Match).resolveShield},
+	EffectManaDrain:  {onDeploy, validateManaDrain, (*Match).resolveManaDrain},
+	EffectSplash:     {onHit, needRatio, (*Match).resolveSplash},
+	EffectPierceKing: {onHit, needRatio, (*Match).resolvePierceKing},
+	EffectDOT:        {onHit, validateDOT, (*Match).resolveDOT},
+}
+
+func needAmount(a Ability) error {
+	if a.Amount <= 0 {
+		return fmt.Errorf("amount must be positive")
+	}
+	return nil
+}
+
+func needRatio(a Ability) error {
+	if a.Ratio <= 0 || a.Ratio > 1 {
+		return fmt.Errorf("ratio must be between 0 and 1")
+	}
+	return nil
+}
+
+func validateManaDrain(a Ability) error {
+	if a.Amount <= 0 || a.Amount > maxMana {
+		return fmt.Errorf("amount must be between 1 and %d", maxMana)
+	}
+	return nil
+}
+
+func validateDOT(a Ability) error {
+	if err := needAmount(a); err != nil {
+		return err
+	}
+	if a.Duration < 1 {
+		return fmt.Errorf("duration must be at least 1 second")
+	}
+	return nil
+}
+
+// validateAbility checks that an ability names a known effect with usable parameters
+func validateAbility(a Ability) error {
+	effect, exists := abilityEffects[a.Effect]
+	if !exists {
+		return fmt.Errorf("unknown effect %q", a.Effect)
+	}
+	if err := effect.validate(a); err != nil {
+		return fmt.Errorf("%s: %v", a.Effect, err)
+	}
+	return nil
+}
+
+// describeAbilities renders abilities as the troop's special text
+func describeAbilities(abilities []Ability) string {
+	var parts []string
+	for _, a := range abilities {
+		switch a.Effect {
+		case EffectHealLowest:
+			parts = append(parts, fmt.Sprintf("Heal %.0f to lowest HP tower", a.Amount))
+		case EffectShield:
+			parts = append(parts, fmt.Sprintf("Shield towers for %.0f", a.Amount))
+		case EffectManaDrain:
+			parts = append(parts, fmt.Sprintf("Drain %.0f enemy mana", a.Amount))
+		case EffectSplash:
+			parts = append(parts, fmt.Sprintf("Splash %.0f%%", a.Ratio*100))
+		case EffectPierceKing:
+			parts = append(parts, fmt.Sprintf("Pierce %.0f%% to King", a.Ratio*100))
+		case EffectDOT:
+			parts = append(parts, fmt.Sprintf("Burn %.0f/s for %ds", a.Amount, a.Duration))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// troopAbilities returns a troop's abilities from the templates
+func (m *Match) troopAbilities(troop *Troop) []Ability {
+	if template := m.templates.troop(troop.Name); template != nil {
+		return template.Abilities
+	}
+	return nil
+}
+
+// resolveAbilities runs the troop's effects for one trigger. Caller must hold stateMux.
+func (m *Match) resolveAbilities(trigger string, ctx *abilityContext) {
+	for _, a := range m.troopAbilities(ctx.troop) {
+		effect, exists := abilityEffects[a.Effect]
+		if !exists || effect.trigger != trigger {
+			continue
+		}
+		effect.resolve(m, ctx, a)
+		if !m.state.IsGameActive {
+			return
+		}
+	}
+}
+
+// announceAbility tells both players what an effect did
+func (m *Match) announceAbility(ctx *abilityContext, a Ability, target string, amount float64, message string) {
+	m.broadcastEvent(MsgAbility, AbilityMessage{
+		Owner:  ctx.attackerName,
+		Troop:  ctx.troop.Name,
+		Effect: a.Effect,
+		Target: target,
+		Amount: amount,
+	}, message)
+}
+
+// weakestTower returns the player's standing tower with the least HP. Towers are
+// walked in a fixed order so ties resolve the same way on replay.
+func weakestTower(player *PlayerData) *Tower {
+	var weakest *Tower
+	for _, pos := range towerPositions {
+		tower := player.Towers[pos]
+		if tower != nil && tower.HP > 0 && (weakest == nil || tower.HP < weakest.HP) {
+			weakest = tower
+		}
+	}
+	return weakest
+}
+
+func (m *Match) resolveHealLowest(ctx *abilityContext, a Ability) {
+	tower := weakestTower(ctx.attacker)
+	if tower == nil {
+		m.announceAbility(ctx, a, "", 0, fmt.Sprintf("💚 %s's %s found no towers to heal.\n", ctx.attackerName, ctx.troop.Name))
+		return
+	}
+
+	oldHP := tower.HP
+	tower.HP = math.Min(tower.HP+a.Amount, tower.MaxHP)
+	healed := tower.HP - oldHP
+	m.announceAbility(ctx, a, tower.Position, healed,
+		fmt.Sprintf("💚 %s's %s healed their %s for %.0f HP! (%.0f -> %.0f)\n",
+			ctx.attackerName, ctx.troop.Name, tower.Type, healed, oldHP, tower.HP))
+}
+
+func (m *Match) resolveShield(ctx *abilityContext, a Ability) {
+	for _, pos := range towerPositions {
+		if tower := ctx.attacker.Towers[pos]; tower != nil && tower.HP > 0 {
+			tower.Shield += a.Amount
+		}
+	}
+	m.announceAbility(ctx, a, "", a.Amount,
+		fmt.Sprintf("🛡️ %s's %s shields their towers for %.0f damage!\n", ctx.attackerName, ctx.troop.Name, a.Amount))
+}
+
+func (m *Match) resolveManaDrain(ctx *abilityContext, a Ability) {
+	mana := &m.state.Player1Mana
+	if ctx.playerNum == 1 {
+		mana = &m.state.Player2Mana
+	}
+	drained := math.Min(a.Amount, *mana)
+	*mana -= drained
+	m.announceAbility(ctx, a, "", drained,
+		fmt.Sprintf("🌀 %s's %s drained %.0f of %s's mana!\n", ctx.attackerName, ctx.troop.Name, drained, ctx.defenderName))
+}
+
+func (m *Match) resolveSplash(ctx *abilityContext, a Ability) {
+	for _, pos := range towerPositions {
+		tower := ctx.defender.Towers[pos]
+		if tower == nil || tower == ctx.target || tower.HP <= 0 {
+			continue
+		}
+		m.abilityDamage(ctx, a, tower, ctx.damage*a.Ratio, "💦", "splashes")
+		if !m.state.IsGameActive {
+			return
+		}
+	}
+}
+
+func (m *Match) resolvePierceKing(ctx *abilityContext, a Ability) {
+	king := ctx.defender.Towers["king"]
+	if king == nil || king == ctx.target || king.HP <= 0 {
+		return
+	}
+	m.abilityDamage(ctx, a, king, ctx.damage*a.Ratio, "🗡️", "pierces through to")
+}
+
+func (m *Match) resolveDOT(ctx *abilityContext, a Ability) {
+	if ctx.target.HP <= 0 {
+		return
+	}
+	m.burns = append(m.burns, &burn{
+		tower:     ctx.target,
+		ctx:       *ctx,
+		ability:   a,
+		remaining: a.Duration,
+	})
+	m.announceAbility(ctx, a, ctx.target.Position, a.Amount,
+		fmt.Sprintf("🔥 %s's %s sets %s's %s on fire (%.0f damage per second for %ds)!\n",
+			ctx.attackerName, ctx.troop.Name, ctx.defenderName, ctx.target.Type, a.Amount, a.Duration))
+}
+
+// abilityDamage deals effect damage to a tower and credits the troop that caused it
+func (m *Match) abilityDamage(ctx *abilityContext, a Ability, tower *Tower, amount float64, icon, verb string) {
+	dealt, absorbed, destroyed := m.damageTower(ctx.playerNum, ctx.troop, tower, amount)
+
+	message := fmt.Sprintf("%s %s's %s %s %s's %s for %.0f damage! HP: %.0f/%.0f\n",
+		icon, ctx.attackerName, ctx.troop.Name, verb, ctx.defenderName, tower.Type, dealt, tower.HP, tower.MaxHP)
+	if absorbed > 0 {
+		message += fmt.Sprintf("🛡️ The shield absorbed %.0f damage.\n", absorbed)
+	}
+	m.announceAbility(ctx, a, tower.Position, dealt, message)
+
+	if destroyed {
+		m.handleTowerDestruction(tower, ctx.playerNum, ctx.attackerName, ctx.defenderName)
+	}
+}
+
+// damageTower applies damage to a tower through its shield and credits the
+// troop with the damage and any destruction. It returns the HP lost, the
+// damage the shield absorbed and whether the tower fell. Caller must hold stateMux.
+func (m *Match) damageTower(playerNum int, troop *Troop, tower *Tower, amount float64) (float64, float64, bool) {
+	absorbed := math.Min(tower.Shield, amount)
+	tower.Shield -= absorbed
+
+	oldHP := tower.HP
+	tower.HP = math.Max(0, tower.HP-(amount-absorbed))
+	dealt := oldHP - tower.HP
+	destroyed := oldHP > 0 && tower.HP <= 0
+
+	m.damageDealt[playerNum-1][troop.Name] += dealt
+	var fallen *Tower
+	if destroyed {
+		fallen = tower
+	}
+	m.awardTroopEXP(troop, dealt, fallen)
+	return dealt, absorbed, destroyed
+}
+
+// burn is a damage-over-time effect on a tower
+type burn struct {
+	tower     *Tower
+	ctx       abilityContext
+	ability   Ability
+	remaining int // seconds left
+}
+
+// tickBurns applies one second of every burn. Caller must hold stateMux.
+func (m *Match) tickBurns() {
+	active := m.burns[:0]
+	for _, b := range m.burns {
+		if !m.state.IsGameActive {
+			return
+		}
+		if b.tower.HP <= 0 {
+			continue
+		}
+		m.abilityDamage(&b.ctx, b.ability, b.tower, b.ability.Amount, "🔥", "burns")
+		if b.remaining--; b.remaining > 0 {
+			active = append(active, b)
+		}
+	}
+	m.burns = active
+}
@@ -0,0 +1,370 @@
+// abilities_test.go
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// abilityCtx is the context of alice's (or bob's) Pawn hitting a tower
+func abilityCtx(m *Match, playerNum int, target string, damage float64) *abilityContext {
+	ctx := &abilityContext{
+		playerNum:    playerNum,
+		troop:        &Troop{Name: "Pawn"},
+		attacker:     m.state.Player1,
+		defender:     m.state.Player2,
+		attackerName: "alice",
+		defenderName: "bob",
+		damage:       damage,
+	}
+	if playerNum == 2 {
+		ctx.attacker, ctx.defender = ctx.defender, ctx.attacker
+		ctx.attackerName, ctx.defenderName = ctx.defenderName, ctx.attackerName
+	}
+	if target != "" {
+		ctx.target = ctx.defender.Towers[target]
+	}
+	return ctx
+}
+
+// setTowerHP overrides the HP of some of a player's towers
+func setTowerHP(player *PlayerData, hp map[string]float64) {
+	for position, value := range hp {
+		player.Towers[position].HP = value
+	}
+}
+
+// towerHPs returns a player's tower HP by position
+func towerHPs(player *PlayerData) map[string]float64 {
+	hp := make(map[string]float64)
+	for position, tower := range player.Towers {
+		hp[position] = tower.HP
+	}
+	return hp
+}
+
+func TestResolveHealLowest(t *testing.T) {
+	tests := []struct {
+		name   string
+		hp     map[string]float64 // the healer's towers before the heal
+		amount float64
+		want   map[string]float64
+	}{
+		{
+			name:   "weakest tower is healed",
+			hp:     map[string]float64{"guard1": 500, "guard2": 100},
+			amount: 300,
+			want:   map[string]float64{"guard1": 500, "guard2": 400, "king": 2000},
+		},
+		{
+			name:   "heal stops at max HP",
+			hp:     map[string]float64{"guard2": 900},
+			amount: 300,
+			want:   map[string]float64{"guard1": 1000, "guard2": 1000, "king": 2000},
+		},
+		{
+			name:   "destroyed towers aren't revived",
+			hp:     map[string]float64{"guard1": 0, "guard2": 500},
+			amount: 300,
+			want:   map[string]float64{"guard1": 0, "guard2": 800, "king": 2000},
+		},
+		{
+			name:   "ties go to the first tower in attack order",
+			hp:     map[string]float64{"guard1": 500, "guard2": 500, "king": 500},
+			amount: 300,
+			want:   map[string]float64{"guard1": 800, "guard2": 500, "king": 500},
+		},
+		{
+			name:   "nothing standing",
+			hp:     map[string]float64{"guard1": 0, "guard2": 0, "king": 0},
+			amount: 300,
+			want:   map[string]float64{"guard1": 0, "guard2": 0, "king": 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestMatch(t)
+			setTowerHP(m.state.Player1, tt.hp)
+
+			m.resolveHealLowest(abilityCtx(m, 1, "", 0), Ability{Effect: EffectHealLowest, Amount: tt.amount})
+			if got := towerHPs(m.state.Player1); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("towers = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveShield(t *testing.T) {
+	tests := []struct {
+		name   string
+		hp     map[string]float64
+		before float64 // shield each tower already has
+		amount float64
+		want   map[string]float64
+	}{
+		{
+			name:   "every standing tower is shielded",
+			amount: 150,
+			want:   map[string]float64{"guard1": 150, "guard2": 150, "king": 150},
+		},
+		{
+			name:   "destroyed towers get no shield",
+			hp:     map[string]float64{"guard1": 0},
+			amount: 150,
+			want:   map[string]float64{"guard1": 0, "guard2": 150, "king": 150},
+		},
+		{
+			name:   "shields stack",
+			before: 50,
+			amount: 150,
+			want:   map[string]float64{"guard1": 200, "guard2": 200, "king": 200},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestMatch(t)
+			setTowerHP(m.state.Player1, tt.hp)
+			for _, tower := range m.state.Player1.Towers {
+				if tower.HP > 0 {
+					tower.Shield = tt.before
+				}
+			}
+
+			m.resolveShield(abilityCtx(m, 1, "", 0), Ability{Effect: EffectShield, Amount: tt.amount})
+			got := make(map[string]float64)
+			for position, tower := range m.state.Player1.Towers {
+				got[position] = tower.Shield
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("shields = %v, want %v", got, tt.want)
+			}
+			for position, tower := range m.state.Player2.Towers {
+				if tower.Shield != 0 {
+					t.Errorf("the opponent's %s was shielded", position)
+				}
+			}
+		})
+	}
+}
+
+func TestDamageTowerThroughShield(t *testing.T) {
+	tests := []struct {
+		name          string
+		hp, shield    float64
+		amount        float64
+		wantDealt     float64
+		wantAbsorbed  float64
+		wantShield    float64
+		wantDestroyed bool
+	}{
+		{"no shield", 1000, 0, 200, 200, 0, 0, false},
+		{"shield absorbs everything", 1000, 300, 200, 0, 200, 100, false},
+		{"shield absorbs part", 1000, 50, 200, 150, 50, 0, false},
+		{"lethal damage stops at zero HP", 100, 0, 200, 100, 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestMatch(t)
+			tower := m.state.Player2.Towers["guard1"]
+			tower.HP, tower.Shield = tt.hp, tt.shield
+			troop := &Troop{Name: "Pawn"}
+
+			dealt, absorbed, destroyed := m.damageTower(1, troop, tower, tt.amount)
+			if dealt != tt.wantDealt || absorbed != tt.wantAbsorbed || destroyed != tt.wantDestroyed {
+				t.Errorf("damageTower() = (%g, %g, %v), want (%g, %g, %v)",
+					dealt, absorbed, destroyed, tt.wantDealt, tt.wantAbsorbed, tt.wantDestroyed)
+			}
+			if tower.HP != tt.hp-tt.wantDealt || tower.Shield != tt.wantShield {
+				t.Errorf("tower HP %g, shield %g; want %g, %g", tower.HP, tower.Shield, tt.hp-tt.wantDealt, tt.wantShield)
+			}
+			if m.damageDealt[0]["Pawn"] != tt.wantDealt {
+				t.Errorf("Pawn credited with %g damage, want %g", m.damageDealt[0]["Pawn"], tt.wantDealt)
+			}
+		})
+	}
+}
+
+func TestResolveManaDrain(t *testing.T) {
+	tests := []struct {
+		name          string
+		playerNum     int
+		opponentMana  float64
+		amount        float64
+		wantRemaining float64
+	}{
+		{"drains the amount", 1, 5, 3, 2},
+		{"can't drain below zero", 1, 2, 3, 0},
+		{"player 2 drains player 1", 2, 7, 4, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestMatch(t)
+			own, opponent := &m.state.Player1Mana, &m.state.Player2Mana
+			if tt.playerNum == 2 {
+				own, opponent = opponent, own
+			}
+			*own, *opponent = 6, tt.opponentMana
+
+			m.resolveManaDrain(abilityCtx(m, tt.playerNum, "", 0), Ability{Effect: EffectManaDrain, Amount: tt.amount})
+			if *opponent != tt.wantRemaining {
+				t.Errorf("opponent mana = %g, want %g", *opponent, tt.wantRemaining)
+			}
+			if *own != 6 {
+				t.Errorf("the drainer's own mana changed to %g", *own)
+			}
+		})
+	}
+}
+
+func TestResolveSplash(t *testing.T) {
+	tests := []struct {
+		name      string
+		hp        map[string]float64 // the defender's towers before the hit
+		shield    float64            // on guard2
+		target    string
+		ratio     float64
+		want      map[string]float64
+		wantDealt float64 // splash damage credited to the troop
+	}{
+		{
+			name:      "other standing towers take a share",
+			target:    "guard1",
+			ratio:     0.5,
+			want:      map[string]float64{"guard1": 1000, "guard2": 900, "king": 1900},
+			wantDealt: 200,
+		},
+		{
+			name:      "destroyed towers are skipped",
+			hp:        map[string]float64{"guard1": 0},
+			target:    "guard2",
+			ratio:     0.25,
+			want:      map[string]float64{"guard1": 0, "guard2": 1000, "king": 1950},
+			wantDealt: 50,
+		},
+		{
+			name:      "shields absorb splash",
+			shield:    60,
+			target:    "guard1",
+			ratio:     0.5,
+			want:      map[string]float64{"guard1": 1000, "guard2": 960, "king": 1900},
+			wantDealt: 140,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestMatch(t)
+			setTowerHP(m.state.Player2, tt.hp)
+			m.state.Player2.Towers["guard2"].Shield = tt.shield
+
+			m.resolveSplash(abilityCtx(m, 1, tt.target, 200), Ability{Effect: EffectSplash, Ratio: tt.ratio})
+			if got := towerHPs(m.state.Player2); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("towers = %v, want %v", got, tt.want)
+			}
+			if got := m.damageDealt[0]["Pawn"]; got != tt.wantDealt {
+				t.Errorf("Pawn credited with %g damage, want %g", got, tt.wantDealt)
+			}
+		})
+	}
+}
+
+func TestResolvePierceKing(t *testing.T) {
+	tests := []struct {
+		name       string
+		kingHP     float64
+		target     string
+		ratio      float64
+		wantKingHP float64
+		wantActive bool
+	}{
+		{"pierces past the guards", 2000, "guard1", 0.5, 1900, true},
+		{"no extra hit when the king is the target", 2000, "king", 0.5, 2000, true},
+		{"a pierce can win the match", 50, "guard2", 0.5, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestMatch(t)
+			m.state.Player2.Towers["king"].HP = tt.kingHP
+
+			m.resolvePierceKing(abilityCtx(m, 1, tt.target, 200), Ability{Effect: EffectPierceKing, Ratio: tt.ratio})
+			if got := m.state.Player2.Towers["king"].HP; got != tt.wantKingHP {
+				t.Errorf("king HP = %g, want %g", got, tt.wantKingHP)
+			}
+			if m.state.IsGameActive != tt.wantActive {
+				t.Errorf("game active = %v, want %v", m.state.IsGameActive, tt.wantActive)
+			}
+			if !tt.wantActive && m.towersDestroyed[0] != 1 {
+				t.Errorf("towers destroyed by alice = %d, want 1", m.towersDestroyed[0])
+			}
+		})
+	}
+}
+
+func TestResolveDOT(t *testing.T) {
+	tests := []struct {
+		name      string
+		targetHP  float64
+		wantBurns int
+	}{
+		{"standing target catches fire", 1000, 1},
+		{"a destroyed target doesn't burn", 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestMatch(t)
+			m.state.Player2.Towers["guard1"].HP = tt.targetHP
+
+			m.resolveDOT(abilityCtx(m, 1, "guard1", 200), Ability{Effect: EffectDOT, Amount: 40, Duration: 3})
+			if len(m.burns) != tt.wantBurns {
+				t.Fatalf("%d burns running, want %d", len(m.burns), tt.wantBurns)
+			}
+			if got := m.state.Player2.Towers["guard1"].HP; got != tt.targetHP {
+				t.Errorf("casting the burn dealt damage: HP %g, want %g", got, tt.targetHP)
+			}
+		})
+	}
+}
+
+func TestTickBurns(t *testing.T) {
+	tests := []struct {
+		name      string
+		durations []int // one 40-per-second burn on guard1 per entry
+		targetHP  float64
+		ticks     int
+		wantHP    float64
+		wantBurns int
+	}{
+		{"burns every second", []int{3}, 1000, 2, 920, 1},
+		{"expires after its duration", []int{3}, 1000, 3, 880, 0},
+		{"nothing after expiry", []int{3}, 1000, 5, 880, 0},
+		{"burns expire independently", []int{1, 3}, 1000, 2, 880, 1},
+		{"a destroyed tower stops burning", []int{5}, 60, 3, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestMatch(t)
+			tower := m.state.Player2.Towers["guard1"]
+			tower.HP = tt.targetHP
+			for _, duration := range tt.durations {
+				m.resolveDOT(abilityCtx(m, 1, "guard1", 200), Ability{Effect: EffectDOT, Amount: 40, Duration: duration})
+			}
+
+			for i := 0; i < tt.ticks; i++ {
+				m.tickBurns()
+			}
+			if tower.HP != tt.wantHP {
+				t.Errorf("HP after %d ticks = %g, want %g", tt.ticks, tower.HP, tt.wantHP)
+			}
+			if len(m.burns) != tt.wantBurns {
+				t.Errorf("%d burns still running, want %d", len(m.burns), tt.wantBurns)
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+// auth.go
+package main
+
+import (
+	"bufio"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// Password hash format: pbkdf2-sha256$<iterations>$<salt>$<hash> (base64, no padding)
+const (
+	passwordHashScheme     = "pbkdf2-sha256"
+	passwordHashIterations = 600000
+	passwordSaltLength     = 16
+	passwordKeyLength      = 32
+)
+
+// hashPassword derives a salted, slow hash for storing a password
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, passwordSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("generating salt: %v", err)
+	}
+
+	key, err := pbkdf2.Key(sha256.New, password, salt, passwordHashIterations, passwordKeyLength)
+	if err != nil {
+		return "", fmt.Errorf("deriving key: %v", err)
+	}
+
+	return fmt.Sprintf("%s$%d$%s$%s", passwordHashScheme, passwordHashIterations,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// isPasswordHash reports whether a stored password is already hashed
+func isPasswordHash(stored string) bool {
+	return strings.HasPrefix(stored, passwordHashScheme+"$")
+}
+
+// verifyPassword checks a password against its stored form in constant time.
+// Legacy plaintext entries are still accepted; needsUpgrade tells the caller
+// to replace them with a hash.
+func verifyPassword(stored, password string) (ok bool, needsUpgrade bool) {
+	if !isPasswordHash(stored) {
+		ok = subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+		return ok, ok
+	}
+
+	parts := strings.Split(stored, "$")
+	if len(parts) != 4 {
+		return false, false
+	}
+
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return false, false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false, false
+	}
+	expected, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false, false
+	}
+
+	key, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(expected))
+	if err != nil {
+		return false, false
+	}
+
+	ok = subtle.ConstantTimeCompare(key, expected) == 1
+	return ok, ok && iterations < passwordHashIterations
+}
+
+// Account rules
+const (
+	usernameMinLength = 3
+	usernameMaxLength = 16
+	passwordMinLength = 6
+	maxSignInAttempts = 3
+)
+
+const usernamePrompt = "Enter username (or 'register' to create an account): \n"
+
+// reservedUsernames cannot be registered (compared case-insensitively)
+var reservedUsernames = map[string]bool{
+	"admin": true, "administrator": true, "root": true, "server": true,
+	"system": true, "moderator": true, "bot": true, "guest": true,
+	"register": true, "login": true, "protocol": true, "quit": true,
+	"all": true, "everyone": true, "spectator": true,
+}
+
+// Sign-in errors shown to the client
+var (
+	errNoSuchAccount    = errors.New("no such account")
+	errWrongPassword    = errors.New("incorrect password")
+	errAccountExists    = errors.New("that username is already taken")
+	errPasswordMismatch = errors.New("passwords do not match")
+	errDisconnected     = errors.New("client disconnected")
+)
+
+// validateUsername enforces the charset, length and reserved-name rules
+func validateUsername(username string) error {
+	if len(username) < usernameMinLength || len(username) > usernameMaxLength {
+		return fmt.Errorf("username must be %d-%d characters long", usernameMinLength, usernameMaxLength)
+	}
+
+	for i, r := range username {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case (r >= '0' && r <= '9') || r == '_' || r == '-':
+			if i == 0 {
+				return errors.New("username must start with a letter")
+			}
+		default:
+			return errors.New("username may only contain letters, digits, '_' and '-'")
+		}
+	}
+
+	if reservedUsernames[strings.ToLower(username)] {
+		return fmt.Errorf("username %q is reserved", username)
+	}
+	return nil
+}
+
+// validatePassword enforces the minimum password rules for new accounts
+func validatePassword(password string) error {
+	if len(password) < passwordMinLength {
+		return fmt.Errorf("password must be at least %d characters long", passwordMinLength)
+	}
+	return nil
+}
+
+// signIn runs the login/registration dialogue starting from the first answer
+// to the username prompt. It returns nil when the client gives up or disconnects.
+func (s *Server) signIn(client *Client, scanner *bufio.Scanner, input string) *PlayerData {
+	for attempt := 1; ; attempt++ {
+		var player *PlayerData
+		var err error
+
+		if strings.EqualFold(input, "register") {
+			player, err = s.registerDialogue(client, scanner)
+		} else {
+			player, err = s.loginDialogue(client, scanner, input)
+		}
+
+		if err == nil {
+			return player
+		}
+		if errors.Is(err, errDisconnected) {
+			log.Println("Client disconnected during sign-in")
+			return nil
+		}
+
+		message := fmt.Sprintf("❌ %s\n", capitalize(err.Error()))
+		if errors.Is(err, errNoSuchAccount) {
+			message += "💡 Type 'register' at the username prompt to create one.\n"
+		}
+		client.SendError(message)
+
+		if attempt >= maxSignInAttempts {
+			client.SendError("Too many failed attempts. Goodbye!\n")
+			return nil
+		}
+
+		client.SendEvent(MsgPrompt, "username", usernamePrompt)
+		var ok bool
+		if input, ok = s.readInput(client, scanner); !ok {
+			return nil
+		}
+	}
+}
+
+// loginDialogue asks for the password of an existing account
+func (s *Server) loginDialogue(client *Client, scanner *bufio.Scanner, username string) (*PlayerData, error) {
+	if username == "" {
+		return nil, errors.New("username cannot be empty")
+	}
+	log.Printf("Received username: '%s'", username)
+	if !s.playerExists(username) {
+		return nil, fmt.Errorf("%w: '%s'", errNoSuchAccount, username)
+	}
+
+	// Gửi password prompt
+	log.Println("Sending password prompt")
+	client.SendEvent(MsgPrompt, "password", "Enter password: \n")
+
+	// Đọc password
+	log.Println("Waiting for password input")
+	password, ok := s.readInput(client, scanner)
+	if !ok {
+		return nil, errDisconnected
+	}
+
+	player, err := s.authenticatePlayer(username, password)
+	if err != nil {
+		log.Printf("Login failed for '%s': %v", username, err)
+		return nil, err
+	}
+	return player, nil
+}
+
+// registerDialogue asks for a new username and a confirmed password
+func (s *Server) registerDialogue(client *Client, scanner *bufio.Scanner) (*PlayerData, error) {
+	client.SendEvent(MsgPrompt, "new_username",
+		fmt.Sprintf("Choose a username (%d-%d letters, digits, '_' or '-'): \n", usernameMinLength, usernameMaxLength))
+	username, ok := s.readInput(client, scanner)
+	if !ok {
+		return nil, errDisconnected
+	}
+	if err := validateUsername(username); err != nil {
+		return nil, err
+	}
+	if s.accountExists(username) {
+		return nil, errAccountExists
+	}
+
+	client.SendEvent(MsgPrompt, "new_password",
+		fmt.Sprintf("Choose a password (at least %d characters): \n", passwordMinLength))
+	password, ok := s.readInput(client, scanner)
+	if !ok {
+		return nil, errDisconnected
+	}
+	if err := validatePassword(password); err != nil {
+		return nil, err
+	}
+
+	client.SendEvent(MsgPrompt, "confirm_password", "Confirm password: \n")
+	confirm, ok := s.readInput(client, scanner)
+	if !ok {
+		return nil, errDisconnected
+	}
+	if subtle.ConstantTimeCompare([]byte(password), []byte(confirm)) != 1 {
+		return nil, errPasswordMismatch
+	}
+
+	player, err := s.registerPlayer(username, password)
+	if err != nil {
+		return nil, err
+	}
+	client.Send(fmt.Sprintf("✅ Account '%s' created!\n", username))
+	return player, nil
+}
+
+// capitalize upper-cases the first letter of a message
+func capitalize(message string) string {
+	if message == "" {
+		return message
+	}
+	return strings.ToUpper(message[:1]) + message[1:]
+}
@@ -0,0 +1,113 @@
+// auth_test.go
+package main
+
+import (
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"testing"
+)
+
+// hashWithIterations builds a stored hash the way an older server with a
+// lower iteration count would have
+func hashWithIterations(t *testing.T, password string, iterations int) string {
+	t.Helper()
+	salt := []byte("0123456789abcdef")
+	key, err := pbkdf2.Key(sha256.New, password, salt, iterations, passwordKeyLength)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fmt.Sprintf("%s$%d$%s$%s", passwordHashScheme, iterations,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+func TestVerifyPassword(t *testing.T) {
+	current, err := hashPassword("secret1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	weak := hashWithIterations(t, "secret1", 1000)
+
+	tests := []struct {
+		name        string
+		stored      string
+		password    string
+		wantOK      bool
+		wantUpgrade bool
+	}{
+		{"legacy plaintext", "secret1", "secret1", true, true},
+		{"legacy plaintext, wrong password", "secret1", "secret2", false, false},
+		{"current hash", current, "secret1", true, false},
+		{"current hash, wrong password", current, "secret2", false, false},
+		{"weaker hash", weak, "secret1", true, true},
+		{"weaker hash, wrong password", weak, "secret2", false, false},
+		{"plaintext that looks like the hash", current, current, false, false},
+		{"missing fields", passwordHashScheme + "$1000$c2FsdA", "secret1", false, false},
+		{"bad iterations", passwordHashScheme + "$x$c2FsdA$a2V5", "secret1", false, false},
+		{"zero iterations", passwordHashScheme + "$0$c2FsdA$a2V5", "secret1", false, false},
+		{"bad salt", passwordHashScheme + "$1000$!!$a2V5", "secret1", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, upgrade := verifyPassword(tt.stored, tt.password)
+			if ok != tt.wantOK || upgrade != tt.wantUpgrade {
+				t.Errorf("verifyPassword() = (%v, %v), want (%v, %v)", ok, upgrade, tt.wantOK, tt.wantUpgrade)
+			}
+		})
+	}
+}
+
+func TestAuthenticatePlayerUpgradesLegacyPassword(t *testing.T) {
+	t.Chdir(t.TempDir())
+	store, err := openJSONStore("players.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(&PlayerData{Username: "alice", Password: "secret1"}); err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{store: store, playerData: make(map[string]*PlayerData)}
+
+	if _, err := s.authenticatePlayer("alice", "wrong1"); err != errWrongPassword {
+		t.Fatalf("wrong password: got error %v, want %v", err, errWrongPassword)
+	}
+	if stored, _ := store.Get("alice"); stored.Password != "secret1" {
+		t.Fatal("a failed login changed the stored password")
+	}
+
+	if _, err := s.authenticatePlayer("alice", "secret1"); err != nil {
+		t.Fatalf("legacy login: %v", err)
+	}
+	stored, err := store.Get("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isPasswordHash(stored.Password) {
+		t.Fatalf("stored password was not upgraded: %q", stored.Password)
+	}
+	if ok, upgrade := verifyPassword(stored.Password, "secret1"); !ok || upgrade {
+		t.Errorf("upgraded hash: verifyPassword() = (%v, %v), want (true, false)", ok, upgrade)
+	}
+	if _, err := s.authenticatePlayer("alice", "secret1"); err != nil {
+		t.Errorf("login after the upgrade: %v", err)
+	}
+}
+
+func TestHashPasswordIsSalted(t *testing.T) {
+	a, err := hashPassword("secret1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := hashPassword("secret1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == b {
+		t.Error("two hashes of the same password are identical")
+	}
+	if !isPasswordHash(a) {
+		t.Errorf("isPasswordHash(%q) = false", a)
+	}
+}
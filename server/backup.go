@@ -0,0 +1,131 @@
+// backup.go
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	backupsDir     = "backups"
+	maxBackups     = 10              // backups kept per data file
+	backupInterval = 5 * time.Minute // minimum time between backups taken while saving
+)
+
+// errCorruptStore marks a data file that exists but can't be read back
+var errCorruptStore = errors.New("data file is corrupt")
+
+// writeFileAtomic replaces path with data so that a crash leaves either the old
+// or the new file, never a torn one: the data goes to a temp file in the same
+// directory, is fsynced, then renamed over path.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Chmod(tmpName, perm); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	return syncDir(dir)
+}
+
+// syncDir flushes a directory entry so a rename survives a crash
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// backupFile copies path into the backups directory under a timestamped name
+// and prunes the oldest backups. A missing file is not an error.
+func backupFile(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(backupsDir, 0755); err != nil {
+		return err
+	}
+	name := filepath.Join(backupsDir, fmt.Sprintf("%s.%s.bak",
+		filepath.Base(path), time.Now().Format("20060102-150405.000")))
+	if err := writeFileAtomic(name, data, 0644); err != nil {
+		return err
+	}
+
+	backups := listBackups(path)
+	for _, old := range backups[min(len(backups), maxBackups):] {
+		os.Remove(old)
+	}
+	return nil
+}
+
+// listBackups returns the backups of path, newest first
+func listBackups(path string) []string {
+	matches, err := filepath.Glob(filepath.Join(backupsDir, filepath.Base(path)+".*.bak"))
+	if err != nil {
+		return nil
+	}
+	// Timestamps sort lexically
+	sort.Sort(sort.Reverse(sort.StringSlice(matches)))
+	return matches
+}
+
+// restoreLatestBackup replaces a corrupt path with its newest backup that passes
+// validate. The corrupt file is kept next to it for inspection.
+func restoreLatestBackup(path string, validate func(data []byte) error) error {
+	for _, backup := range listBackups(path) {
+		data, err := os.ReadFile(backup)
+		if err != nil {
+			continue
+		}
+		if err := validate(data); err != nil {
+			log.Printf("Backup %s is not usable: %v", backup, err)
+			continue
+		}
+
+		corrupt := path + ".corrupt-" + time.Now().Format("20060102-150405")
+		if err := os.Rename(path, corrupt); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := writeFileAtomic(path, data, 0644); err != nil {
+			return err
+		}
+		log.Printf("Restored %s from %s (corrupt file kept as %s)", path, backup, corrupt)
+		return nil
+	}
+	return fmt.Errorf("no usable backup of %s in %s/", path, backupsDir)
+}
@@ -0,0 +1,121 @@
+// backup_test.go
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRestoreLatestBackup(t *testing.T) {
+	const (
+		corrupt = `{"version": 4, "players": {`
+		older   = `{"version": 4, "players": {"alice": {"username": "alice"}}}`
+		newer   = `{"version": 4, "players": {"alice": {"username": "alice"}, "bob": {"username": "bob"}}}`
+	)
+
+	tests := []struct {
+		name    string
+		backups []string // oldest first
+		want    string   // restored contents; empty when restoring must fail
+	}{
+		{"newest backup is good", []string{older, newer}, newer},
+		{"newest backup is corrupt too", []string{older, newer, corrupt}, newer},
+		{"skips every corrupt backup", []string{older, corrupt, corrupt}, older},
+		{"only backup is good", []string{older}, older},
+		{"every backup is corrupt", []string{corrupt, corrupt}, ""},
+		{"no backups", nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			if err := os.WriteFile("players.json", []byte(corrupt), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.MkdirAll(backupsDir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			for i, data := range tt.backups {
+				name := filepath.Join(backupsDir, fmt.Sprintf("players.json.20260101-0000%02d.000.bak", i))
+				if err := os.WriteFile(name, []byte(data), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := restoreLatestBackup("players.json", validatePlayersJSON)
+			got, readErr := os.ReadFile("players.json")
+			if readErr != nil {
+				t.Fatal(readErr)
+			}
+
+			if tt.want == "" {
+				if err == nil {
+					t.Fatal("restoreLatestBackup() succeeded, want an error")
+				}
+				if string(got) != corrupt {
+					t.Errorf("a failed restore changed the file to %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("restoreLatestBackup() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("restored %q, want %q", got, tt.want)
+			}
+
+			// The corrupt file is kept for inspection
+			kept, _ := filepath.Glob("players.json.corrupt-*")
+			if len(kept) != 1 {
+				t.Fatalf("found %d copies of the corrupt file, want 1", len(kept))
+			}
+			if data, _ := os.ReadFile(kept[0]); string(data) != corrupt {
+				t.Errorf("kept corrupt file holds %q", data)
+			}
+		})
+	}
+}
+
+func TestBackupFilePrunesOldBackups(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll(backupsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < maxBackups+3; i++ {
+		name := filepath.Join(backupsDir, fmt.Sprintf("players.json.20260101-0000%02d.000.bak", i))
+		if err := os.WriteFile(name, []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile("players.json", []byte(`{"version": 4}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := backupFile("players.json"); err != nil {
+		t.Fatal(err)
+	}
+
+	backups := listBackups("players.json")
+	if len(backups) != maxBackups {
+		t.Fatalf("%d backups kept, want %d", len(backups), maxBackups)
+	}
+	if data, _ := os.ReadFile(backups[0]); string(data) != `{"version": 4}` {
+		t.Errorf("newest backup holds %q, want the current file", data)
+	}
+	if oldest := backups[len(backups)-1]; !strings.Contains(oldest, "20260101-000004") {
+		t.Errorf("oldest kept backup is %s, want the fifth one written", oldest)
+	}
+}
+
+func TestBackupFileMissingIsNotAnError(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := backupFile("players.json"); err != nil {
+		t.Fatalf("backupFile() of a missing file error = %v", err)
+	}
+	if backups := listBackups("players.json"); len(backups) != 0 {
+		t.Errorf("backups of a missing file: %v", backups)
+	}
+}
@@ -0,0 +1,332 @@
+// bot.go
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// Bot difficulties
+const (
+	BotEasy   = "easy"   // random legal moves
+	BotMedium = "medium" // the move dealing the most damage right now
+	BotHard   = "hard"   // plans around mana, kills, counterattacks and heals
+)
+
+const (
+	botThinkInterval = time.Second // how often a bot looks for a move
+	botKillBonus     = 300.0       // value of destroying a guard tower, on top of the damage
+	botWinBonus      = 1e6         // value of destroying the King Tower
+	botSaveRatio     = 0.6         // hard bots wait for mana when the best playable move is worth less than this share of the best move
+)
+
+// validDifficulty reports whether name is a known bot difficulty
+func validDifficulty(name string) bool {
+	return name == BotEasy || name == BotMedium || name == BotHard
+}
+
+// Bot is a server-side player that fills the second slot of a practice match
+type Bot struct {
+	difficulty string
+	client     *Client
+	player     *PlayerData
+	rng        *rand.Rand // the bot's own choices; match randomness stays on the match RNG
+}
+
+// botMove is one attack command: a deck slot (0-based) and a target
+type botMove struct {
+	slot   int
+	target string
+	value  float64
+	mana   float64
+}
+
+// newBot creates a bot whose units mirror the levels of the human's units, so
+// practice is as hard at level 10 as at level 1
+func newBot(difficulty string, human *PlayerData, templates *GameTemplates) *Bot {
+	player := &PlayerData{
+		Username: "Bot." + capitalize(difficulty), // '.' can't appear in account names
+		Level:    human.Level,
+		Rating:   defaultRating,
+		Towers:   defaultTowers(templates),
+		Troops:   make([]*Troop, 0),
+	}
+	syncCollection(player, templates)
+
+	for _, troop := range player.Troops {
+		if card := human.card(troop.Name); card != nil {
+			troop.Level = card.Level
+		}
+	}
+	for pos, tower := range player.Towers {
+		if own := human.Towers[pos]; own != nil {
+			tower.Level = own.Level
+		}
+	}
+
+	bot := &Bot{difficulty: difficulty, player: player, rng: newRand(newSeed())}
+	player.Deck = randomDeck(player, bot.rng)
+	bot.client = &Client{Username: player.Username, conn: discardConn{}, bot: bot}
+	return bot
+}
+
+// startPractice starts an unranked match between a client and a bot
+func (s *Server) startPractice(client *Client, difficulty, mode string) {
+	human := s.loadPlayerData(client.Username)
+	if human == nil {
+		client.SendError("❌ Could not load your player data.\n")
+		return
+	}
+	if err := validateDeck(human, human.Deck); err != nil {
+		client.SendError(fmt.Sprintf("❌ Your deck is invalid: %v\n💡 Fix it with 'deck set' before practicing.\n", err))
+		return
+	}
+	if s.matchmaker.isPaired(client) {
+		client.SendError("❌ An opponent was just found; your match is starting.\n")
+		return
+	}
+	s.matchmaker.remove(client)
+
+	bot := newBot(difficulty, human, s.currentTemplates())
+	match := s.registerMatch(client, bot.client, mode)
+	if match == nil {
+		client.SendError("❌ You are already in a match.\n")
+		return
+	}
+	match.practice = true
+
+	log.Printf("Match #%s started: %s vs %s (%s practice, seed %d)", match.ID, client.Username, bot.player.Username, mode, match.seed)
+	client.Send(fmt.Sprintf("🤖 Practice match against %s. No EXP or rating is at stake.\n", bot.player.Username))
+	match.start()
+	go bot.run(match)
+}
+
+// run plays the bot's side until the match ends
+func (b *Bot) run(m *Match) {
+	ticker := time.NewTicker(botThinkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C:
+		}
+
+		m.stateMux.RLock()
+		move := b.choose(m)
+		m.stateMux.RUnlock()
+		if move == nil {
+			continue
+		}
+
+		playerNum := 2
+		if !m.submit(func() {
+			m.processAttackWithTurns(b.client, playerNum, move.slot, move.target)
+		}) {
+			return
+		}
+	}
+}
+
+// choose picks the bot's next move, or nil to wait. Caller must hold stateMux.
+func (b *Bot) choose(m *Match) *botMove {
+	if m.state == nil || !m.state.IsGameActive || !m.hasTurn(2) {
+		return nil
+	}
+
+	playable, best := b.evaluate(m, m.state.Player2Mana)
+	if len(playable) == 0 {
+		return nil
+	}
+
+	switch b.difficulty {
+	case BotEasy:
+		return playable[b.rng.Intn(len(playable))]
+
+	case BotMedium:
+		return highestValue(playable)
+
+	default:
+		move := highestValue(playable)
+		// Save up for a much better move instead of spending the mana now
+		if best != nil && best.mana > m.state.Player2Mana && move.value < botSaveRatio*best.value {
+			return nil
+		}
+		return move
+	}
+}
+
+// evaluate scores every move the bot could make. It returns the moves it can
+// afford now and the best move regardless of mana.
+func (b *Bot) evaluate(m *Match, mana float64) ([]*botMove, *botMove) {
+	defender := m.state.Player1
+	target := nextTarget(defender, nil)
+
+	var playable []*botMove
+	var best *botMove
+	for slot, troop := range m.deck(2) {
+		if troop.HP <= 0 {
+			continue
+		}
+		move := &botMove{slot: slot, target: target, mana: troop.MANA}
+		switch b.difficulty {
+		case BotMedium:
+			move.value = b.attackDamage(m, troop, defender.Towers[target])
+		case BotHard:
+			move.value = b.plan(m, troop, target, mana-troop.MANA)
+		}
+
+		if troop.MANA <= mana {
+			playable = append(playable, move)
+		}
+		if best == nil || move.value > best.value {
+			best = move
+		}
+	}
+	return playable, best
+}
+
+// highestValue returns the move with the highest value; ties keep deck order
+func highestValue(moves []*botMove) *botMove {
+	best := moves[0]
+	for _, move := range moves[1:] {
+		if move.value > best.value {
+			best = move
+		}
+	}
+	return best
+}
+
+// nextTarget returns the only tower that may be attacked, following the
+// guard1 → guard2 → king order of canAttackTarget. A destroyed tower is
+// treated as already down, for planning ahead.
+func nextTarget(defender *PlayerData, destroyed *Tower) string {
+	for _, pos := range towerPositions {
+		if tower := defender.Towers[pos]; tower != nil && tower != destroyed && tower.HP > 0 {
+			return pos
+		}
+	}
+	return "king"
+}
+
+// attackDamage is the expected HP a troop takes off a tower, shield included
+func (b *Bot) attackDamage(m *Match, troop *Troop, tower *Tower) float64 {
+	if tower == nil || tower.HP <= 0 || troop.ATK <= 0 {
+		return 0
+	}
+	critChance, critMultiplier := m.troopCrit(troop)
+	damage := m.damage.Expected(troop.ATK, tower.DEF, critChance, critMultiplier)
+	return math.Min(math.Max(damage-tower.Shield, 0), tower.HP)
+}
+
+// plan values playing a troop: the damage and abilities now, the tower it may
+// destroy, the counterattack it may not survive, and in turn-based mode the
+// best follow-up with the mana left when a kill earns a bonus turn
+func (b *Bot) plan(m *Match, troop *Troop, target string, manaLeft float64) float64 {
+	defender := m.state.Player1
+	tower := defender.Towers[target]
+	value := b.abilityValue(m, troop)
+	if troop.ATK <= 0 || tower == nil {
+		return value
+	}
+
+	critChance, critMultiplier := m.troopCrit(troop)
+	raw := m.damage.Expected(troop.ATK, tower.DEF, critChance, critMultiplier)
+	dealt := b.attackDamage(m, troop, tower)
+	value += dealt
+
+	for _, a := range m.troopAbilities(troop) {
+		switch a.Effect {
+		case EffectSplash:
+			for _, pos := range towerPositions {
+				if other := defender.Towers[pos]; other != nil && other != tower && other.HP > 0 {
+					value += math.Min(raw*a.Ratio, other.HP)
+				}
+			}
+		case EffectPierceKing:
+			if king := defender.Towers["king"]; king != nil && king != tower {
+				value += math.Min(raw*a.Ratio, king.HP)
+			}
+		case EffectDOT:
+			value += a.Amount * float64(a.Duration)
+		}
+	}
+
+	if dealt < tower.HP {
+		// The tower survives and strikes back
+		towerCritChance, towerCritMultiplier := m.towerCrit(tower)
+		if m.damage.Expected(tower.ATK, troop.DEF, towerCritChance, towerCritMultiplier) >= troop.HP {
+			value -= troop.ATK / 2 // losing the troop costs its future attacks
+		}
+		return value
+	}
+
+	if tower.Type == "King Tower" {
+		return value + botWinBonus
+	}
+	value += botKillBonus
+
+	// Destroying a tower in turn-based mode earns another turn
+	if m.mode == ModeTurnBased {
+		next := defender.Towers[nextTarget(defender, tower)]
+		follow := 0.0
+		for _, other := range m.deck(2) {
+			if other != troop && other.HP > 0 && other.MANA <= manaLeft && other.ATK > 0 {
+				follow = math.Max(follow, b.attackDamage(m, other, next))
+			}
+		}
+		value += follow
+	}
+	return value
+}
+
+// abilityValue estimates what a troop's deploy effects are worth right now
+func (b *Bot) abilityValue(m *Match, troop *Troop) float64 {
+	value := 0.0
+	for _, a := range m.troopAbilities(troop) {
+		switch a.Effect {
+		case EffectHealLowest:
+			// Healing only helps a damaged tower; topping up a full one is wasted
+			if tower := weakestTower(m.state.Player2); tower != nil {
+				value += math.Min(a.Amount, tower.MaxHP-tower.HP)
+			}
+		case EffectShield:
+			for _, pos := range towerPositions {
+				if tower := m.state.Player2.Towers[pos]; tower != nil && tower.HP > 0 {
+					value += a.Amount / 2
+				}
+			}
+		case EffectManaDrain:
+			value += math.Min(a.Amount, m.state.Player1Mana) * 40
+		}
+	}
+	return value
+}
+
+// handlePracticeCommand processes "practice [easy|medium|hard] [turn|realtime]"
+func (s *Server) handlePracticeCommand(client *Client, args []string) {
+	if client.inMatch() {
+		client.SendError("❌ You are already in a match.\n")
+		return
+	}
+
+	difficulty, mode := BotMedium, ModeTurnBased
+	for _, arg := range args {
+		switch {
+		case validDifficulty(arg):
+			difficulty = arg
+		case validMode(arg):
+			mode = arg
+		default:
+			client.SendError(fmt.Sprintf("❌ Unknown option '%s'. Use: practice [%s] [turn|realtime]\n",
+				arg, strings.Join([]string{BotEasy, BotMedium, BotHard}, "|")))
+			return
+		}
+	}
+	s.startPractice(client, difficulty, mode)
+}
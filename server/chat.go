@@ -0,0 +1,326 @@
+// chat.go
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Chat channels
+const (
+	ChatMatch   = "match"   // players of a match and its spectators
+	ChatLobby   = "lobby"   // everyone online
+	ChatWhisper = "whisper" // one recipient
+)
+
+const (
+	defaultChatFilterFile = "chat_filter.txt"
+	chatMaxLength         = 200              // characters per message
+	chatBurst             = 5                // messages allowed per chatWindow
+	chatWindow            = 10 * time.Second // rate limit window
+)
+
+// ChatMessage is a chat line delivered to a client
+type ChatMessage struct {
+	Channel string `json:"channel"`
+	From    string `json:"from"`
+	To      string `json:"to,omitempty"`
+	Text    string `json:"text"`
+}
+
+// loadChatFilter reads the word filter: one word or phrase per line, '#'
+// starts a comment. A missing file disables the filter.
+func (s *Server) loadChatFilter(path string) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if word := strings.TrimSpace(line); word != "" {
+			words = append(words, regexp.QuoteMeta(word))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(words) == 0 {
+		return nil
+	}
+
+	// Whole words only, so filtering "ass" leaves "class" alone
+	s.chatFilter = regexp.MustCompile(`(?i)\b(` + strings.Join(words, "|") + `)\b`)
+	return nil
+}
+
+// filterChat masks filtered words with asterisks
+func (s *Server) filterChat(text string) string {
+	if s.chatFilter == nil {
+		return text
+	}
+	return s.chatFilter.ReplaceAllStringFunc(text, func(word string) string {
+		return strings.Repeat("*", utf8.RuneCountInString(word))
+	})
+}
+
+// allowChat applies the rate limit, reporting how long to wait when exceeded
+func (c *Client) allowChat(now time.Time) (bool, time.Duration) {
+	c.chatMux.Lock()
+	defer c.chatMux.Unlock()
+
+	recent := c.chatTimes[:0]
+	for _, sent := range c.chatTimes {
+		if now.Sub(sent) < chatWindow {
+			recent = append(recent, sent)
+		}
+	}
+	c.chatTimes = recent
+
+	if len(c.chatTimes) >= chatBurst {
+		return false, chatWindow - now.Sub(c.chatTimes[0])
+	}
+	c.chatTimes = append(c.chatTimes, now)
+	return true, 0
+}
+
+// hasMuted reports whether the client doesn't want to hear from username
+func (c *Client) hasMuted(username string) bool {
+	c.chatMux.Lock()
+	defer c.chatMux.Unlock()
+
+	return c.muted[username]
+}
+
+// mutedList returns the muted usernames, sorted
+func (c *Client) mutedList() []string {
+	c.chatMux.Lock()
+	defer c.chatMux.Unlock()
+
+	usernames := make([]string, 0, len(c.muted))
+	for username := range c.muted {
+		usernames = append(usernames, username)
+	}
+	sort.Strings(usernames)
+	return usernames
+}
+
+// setMutes replaces the muted set with a saved list
+func (c *Client) setMutes(usernames []string) {
+	c.chatMux.Lock()
+	defer c.chatMux.Unlock()
+
+	c.muted = make(map[string]bool)
+	for _, username := range usernames {
+		c.muted[username] = true
+	}
+}
+
+// deliverChat sends a chat line unless the recipient muted the sender
+func deliverChat(recipient *Client, msg ChatMessage, text string) {
+	if recipient == nil || recipient.hasMuted(msg.From) {
+		return
+	}
+	recipient.SendEvent(MsgChat, msg, text)
+}
+
+// chatText returns input with its first n words removed, keeping the
+// original case and spacing of the rest
+func chatText(input string, n int) string {
+	rest := strings.TrimSpace(input)
+	for i := 0; i < n; i++ {
+		_, rest, _ = strings.Cut(rest, " ")
+		rest = strings.TrimSpace(rest)
+	}
+	return rest
+}
+
+// prepareChat validates, rate-limits and filters a message. It returns false
+// after telling the sender why the message was not sent.
+func (s *Server) prepareChat(client *Client, text string, usage string) (string, bool) {
+	if text == "" {
+		client.SendError(fmt.Sprintf("Usage: %s\n", usage))
+		return "", false
+	}
+	if utf8.RuneCountInString(text) > chatMaxLength {
+		client.SendError(fmt.Sprintf("❌ Message too long (max %d characters).\n", chatMaxLength))
+		return "", false
+	}
+	if ok, wait := client.allowChat(time.Now()); !ok {
+		client.SendError(fmt.Sprintf("⏳ Slow down! You can chat again in %.0f seconds.\n", wait.Seconds()+0.5))
+		return "", false
+	}
+	return s.filterChat(text), true
+}
+
+// handleSayCommand sends a message to everyone in the client's match
+func (s *Server) handleSayCommand(client *Client, input string) {
+	if client.Spectating() != nil {
+		client.SendError("👀 Spectators can't chat with the players. Use 'all <msg>' instead.\n")
+		return
+	}
+	match, _ := client.Match()
+	if match == nil || !match.isActive() {
+		client.SendError("❌ You are not in a match. Use 'all <msg>' to talk to everyone online.\n")
+		return
+	}
+
+	text, ok := s.prepareChat(client, chatText(input, 1), "say <message>")
+	if !ok {
+		return
+	}
+	msg := ChatMessage{Channel: ChatMatch, From: client.Username, Text: text}
+	line := fmt.Sprintf("💬 %s: %s\n", client.Username, text)
+
+	match.stateMux.RLock()
+	defer match.stateMux.RUnlock()
+	for _, player := range match.players {
+		deliverChat(player, msg, line)
+	}
+	match.spectatorsMux.Lock()
+	defer match.spectatorsMux.Unlock()
+	for spectator := range match.spectators {
+		deliverChat(spectator, msg, line)
+	}
+}
+
+// handleAllCommand sends a message to everyone online
+func (s *Server) handleAllCommand(client *Client, input string) {
+	text, ok := s.prepareChat(client, chatText(input, 1), "all <message>")
+	if !ok {
+		return
+	}
+	msg := ChatMessage{Channel: ChatLobby, From: client.Username, Text: text}
+	line := fmt.Sprintf("📢 [all] %s: %s\n", client.Username, text)
+
+	s.clientsMux.RLock()
+	defer s.clientsMux.RUnlock()
+	for _, recipient := range s.clients {
+		deliverChat(recipient, msg, line)
+	}
+}
+
+// onlineClient finds a logged-in client by username
+func (s *Server) onlineClient(username string) *Client {
+	s.clientsMux.RLock()
+	defer s.clientsMux.RUnlock()
+
+	return s.clients[username]
+}
+
+// handleWhisperCommand sends a private message to one online player
+func (s *Server) handleWhisperCommand(client *Client, input string) {
+	fields := strings.Fields(input)
+	if len(fields) < 3 {
+		client.SendError("Usage: whisper <user> <message>\n")
+		return
+	}
+	recipient := s.onlineClient(fields[1])
+	if recipient == nil {
+		client.SendError(fmt.Sprintf("❌ %s is not online.\n", fields[1]))
+		return
+	}
+	if recipient == client {
+		client.SendError("❌ You can't whisper to yourself.\n")
+		return
+	}
+
+	text, ok := s.prepareChat(client, chatText(input, 2), "whisper <user> <message>")
+	if !ok {
+		return
+	}
+	msg := ChatMessage{Channel: ChatWhisper, From: client.Username, To: recipient.Username, Text: text}
+	// A muted sender isn't told, so muting can't be probed
+	deliverChat(recipient, msg, fmt.Sprintf("💌 %s whispers: %s\n", client.Username, text))
+	client.SendEvent(MsgChat, msg, fmt.Sprintf("💌 To %s: %s\n", recipient.Username, text))
+}
+
+// handleMuteCommand processes "mute [user]" and "unmute <user>". Mutes are
+// saved with the account and apply to every chat channel.
+func (s *Server) handleMuteCommand(client *Client, args []string, mute bool) {
+	muted := client.mutedList()
+	if len(args) == 0 {
+		if !mute {
+			client.SendError("Usage: unmute <user>\n")
+			return
+		}
+		if len(muted) == 0 {
+			client.Send("🔊 You haven't muted anyone.\n")
+		} else {
+			client.Send(fmt.Sprintf("🔇 Muted: %s\n", strings.Join(muted, ", ")))
+		}
+		return
+	}
+
+	target := args[0]
+	if target == client.Username {
+		client.SendError("❌ You can't mute yourself.\n")
+		return
+	}
+
+	if mute {
+		if client.hasMuted(target) {
+			client.SendError(fmt.Sprintf("❌ %s is already muted.\n", target))
+			return
+		}
+		if _, err := s.store.Get(target); err != nil {
+			client.SendError(fmt.Sprintf("❌ Player %s not found.\n", target))
+			return
+		}
+		muted = append(muted, target)
+		sort.Strings(muted)
+	} else {
+		index := slices.Index(muted, target)
+		if index < 0 {
+			client.SendError(fmt.Sprintf("❌ %s is not muted.\n", target))
+			return
+		}
+		muted = slices.Delete(muted, index, index+1)
+	}
+
+	if err := s.saveMutes(client.Username, muted); err != nil {
+		fmt.Printf("Error saving mutes of %s: %v\n", client.Username, err)
+		client.SendError("❌ Could not save your mute list, please try again later.\n")
+		return
+	}
+	client.setMutes(muted)
+	if mute {
+		client.Send(fmt.Sprintf("🔇 Muted %s. Type 'unmute %s' to hear them again.\n", target, target))
+	} else {
+		client.Send(fmt.Sprintf("🔊 Unmuted %s.\n", target))
+	}
+}
+
+// saveMutes stores a new mute list. Only that field is written: the cached
+// player may be in a match, whose half-played towers and troops must not be
+// saved, so the store record is updated in place and the cache gets a copy.
+func (s *Server) saveMutes(username string, muted []string) error {
+	err := s.store.Update(username, func(player *PlayerData) error {
+		player.Muted = slices.Clone(muted)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.dataMux.Lock()
+	defer s.dataMux.Unlock()
+	if cached, exists := s.playerData[username]; exists {
+		cached.Muted = slices.Clone(muted)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+// damage.go
+package main
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// Defaults used when game_templates.json has no damage section
+const (
+	defaultDamageFormula   = "flat"
+	defaultCritMultiplier  = 1.2
+	defaultMitigationScale = 1000
+)
+
+// DamageConfig selects and tunes the damage formula
+type DamageConfig struct {
+	Formula         string  `json:"formula"`                    // "flat" or "percent"
+	MinDamage       float64 `json:"min_damage"`                 // floor applied after mitigation
+	CritMultiplier  float64 `json:"crit_multiplier"`            // default for units without their own
+	MitigationScale float64 `json:"mitigation_scale,omitempty"` // DEF giving 50% reduction in "percent"
+}
+
+// DamageFormula turns raw attack into damage after the defender's DEF
+type DamageFormula interface {
+	Mitigate(attack, defense float64) float64
+}
+
+// flatFormula subtracts DEF from ATK (the original TCR rule)
+type flatFormula struct{}
+
+func (flatFormula) Mitigate(attack, defense float64) float64 {
+	return attack - defense
+}
+
+// percentFormula reduces ATK by DEF/(DEF+scale), so DEF never fully blocks damage
+type percentFormula struct {
+	scale float64
+}
+
+func (f percentFormula) Mitigate(attack, defense float64) float64 {
+	if defense <= 0 {
+		return attack
+	}
+	return attack * f.scale / (defense + f.scale)
+}
+
+// damageFormulas registers the formulas selectable from config
+var damageFormulas = map[string]func(cfg DamageConfig) DamageFormula{
+	"flat": func(cfg DamageConfig) DamageFormula {
+		return flatFormula{}
+	},
+	"percent": func(cfg DamageConfig) DamageFormula {
+		scale := cfg.MitigationScale
+		if scale <= 0 {
+			scale = defaultMitigationScale
+		}
+		return percentFormula{scale: scale}
+	},
+}
+
+// DamageModel resolves attacks using the configured formula, floor and crits
+type DamageModel struct {
+	formula        DamageFormula
+	minDamage      float64
+	critMultiplier float64
+}
+
+// newDamageModel builds a damage model from config
+func newDamageModel(cfg DamageConfig) (*DamageModel, error) {
+	name := cfg.Formula
+	if name == "" {
+		name = defaultDamageFormula
+	}
+
+	factory, exists := damageFormulas[name]
+	if !exists {
+		return nil, fmt.Errorf("unknown damage formula %q", name)
+	}
+
+	critMultiplier := cfg.CritMultiplier
+	if critMultiplier <= 0 {
+		critMultiplier = defaultCritMultiplier
+	}
+
+	return &DamageModel{
+		formula:        factory(cfg),
+		minDamage:      cfg.MinDamage,
+		critMultiplier: critMultiplier,
+	}, nil
+}
+
+// defaultDamageModel returns the original flat model with 1.2x crits
+func defaultDamageModel() *DamageModel {
+	model, _ := newDamageModel(DamageConfig{})
+	return model
+}
+
+// Expected returns the average damage of an attack over crit rolls, without
+// consuming randomness. Bots use it to evaluate moves.
+func (dm *DamageModel) Expected(attack, defense, critChance, critMultiplier float64) float64 {
+	if critMultiplier <= 0 {
+		critMultiplier = dm.critMultiplier
+	}
+	normal := dm.mitigate(attack, defense)
+	critical := dm.mitigate(attack*critMultiplier, defense)
+	return normal*(1-critChance) + critical*critChance
+}
+
+// mitigate applies DEF and the damage floor
+func (dm *DamageModel) mitigate(attack, defense float64) float64 {
+	damage := dm.formula.Mitigate(attack, defense)
+	if damage < dm.minDamage {
+		damage = dm.minDamage
+	}
+	if damage < 0 {
+		damage = 0
+	}
+	return damage
+}
+
+// Compute rolls for a critical hit with rng and applies mitigation and the damage
+// floor. A critMultiplier of 0 uses the model's default.
+func (dm *DamageModel) Compute(rng *rand.Rand, attack, defense, critChance, critMultiplier float64) (float64, bool) {
+	damage := attack
+
+	// Apply critical hit
+	crit := false
+	if critChance > 0 && rng.Float64() < critChance {
+		if critMultiplier <= 0 {
+			critMultiplier = dm.critMultiplier
+		}
+		damage *= critMultiplier
+		crit = true
+	}
+
+	// Apply defense
+	return dm.mitigate(damage, defense), crit
+}
@@ -0,0 +1,150 @@
+// damage_test.go
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDamageModelMitigation(t *testing.T) {
+	tests := []struct {
+		name            string
+		cfg             DamageConfig
+		attack, defense float64
+		want            float64
+	}{
+		{"flat subtracts def", DamageConfig{}, 300, 100, 200},
+		{"flat never heals", DamageConfig{Formula: "flat"}, 100, 300, 0},
+		{"flat with a floor", DamageConfig{Formula: "flat", MinDamage: 10}, 100, 300, 10},
+		{"flat above the floor", DamageConfig{Formula: "flat", MinDamage: 10}, 300, 100, 200},
+		{"negative floor is ignored", DamageConfig{Formula: "flat", MinDamage: -50}, 100, 300, 0},
+		{"percent halves at the default scale", DamageConfig{Formula: "percent"}, 1000, defaultMitigationScale, 500},
+		{"percent with its own scale", DamageConfig{Formula: "percent", MitigationScale: 500}, 200, 500, 100},
+		{"percent without def", DamageConfig{Formula: "percent"}, 300, 0, 300},
+		{"percent never blocks everything", DamageConfig{Formula: "percent"}, 100, 9000, 10},
+		{"percent with a floor", DamageConfig{Formula: "percent", MinDamage: 25}, 100, 9000, 25},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model, err := newDamageModel(tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			damage, crit := model.Compute(newRand(1), tt.attack, tt.defense, 0, 0)
+			if crit {
+				t.Error("critical hit with a crit chance of 0")
+			}
+			if math.Abs(damage-tt.want) > 1e-9 {
+				t.Errorf("Compute(%g, %g) = %g, want %g", tt.attack, tt.defense, damage, tt.want)
+			}
+			if expected := model.Expected(tt.attack, tt.defense, 0, 0); math.Abs(expected-tt.want) > 1e-9 {
+				t.Errorf("Expected(%g, %g) = %g, want %g", tt.attack, tt.defense, expected, tt.want)
+			}
+		})
+	}
+}
+
+func TestDamageModelCrits(t *testing.T) {
+	tests := []struct {
+		name           string
+		cfg            DamageConfig
+		critMultiplier float64 // the unit's own; 0 uses the model's
+		want           float64 // damage of a 300 ATK crit against 100 DEF
+	}{
+		{"default multiplier", DamageConfig{}, 0, 300*defaultCritMultiplier - 100},
+		{"template multiplier", DamageConfig{CritMultiplier: 1.5}, 0, 350},
+		{"unit multiplier beats the template", DamageConfig{CritMultiplier: 1.5}, 2, 500},
+		{"crit goes through percent mitigation", DamageConfig{Formula: "percent", CritMultiplier: 2}, 0, 600 * 1000 / 1100.0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model, err := newDamageModel(tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			damage, crit := model.Compute(newRand(1), 300, 100, 1, tt.critMultiplier)
+			if !crit {
+				t.Fatal("no critical hit with a crit chance of 1")
+			}
+			if math.Abs(damage-tt.want) > 1e-9 {
+				t.Errorf("crit damage = %g, want %g", damage, tt.want)
+			}
+			if expected := model.Expected(300, 100, 1, tt.critMultiplier); math.Abs(expected-tt.want) > 1e-9 {
+				t.Errorf("Expected() with certain crits = %g, want %g", expected, tt.want)
+			}
+		})
+	}
+}
+
+func TestDamageModelExpectedBlendsCrits(t *testing.T) {
+	model := defaultDamageModel()
+	// 25% of 500 (a 2x crit) and 75% of 200
+	if got := model.Expected(300, 100, 0.25, 2); math.Abs(got-275) > 1e-9 {
+		t.Errorf("Expected() = %g, want 275", got)
+	}
+}
+
+func TestDamageModelRollsAreSeeded(t *testing.T) {
+	model := defaultDamageModel()
+	a, b := newRand(42), newRand(42)
+	crits := 0
+	for i := 0; i < 200; i++ {
+		damageA, critA := model.Compute(a, 300, 100, 0.3, 0)
+		damageB, critB := model.Compute(b, 300, 100, 0.3, 0)
+		if damageA != damageB || critA != critB {
+			t.Fatalf("attack %d differs with the same seed: %g/%v vs %g/%v", i, damageA, critA, damageB, critB)
+		}
+		if critA {
+			crits++
+		}
+	}
+	if crits < 30 || crits > 90 {
+		t.Errorf("%d crits in 200 attacks at a 30%% chance", crits)
+	}
+
+	// No crit chance means no roll, so the sequence isn't shifted
+	rng, fresh := newRand(7), newRand(7)
+	model.Compute(rng, 300, 100, 0, 0)
+	if rng.Float64() != fresh.Float64() {
+		t.Error("an attack without crit chance consumed randomness")
+	}
+}
+
+func TestNewDamageModelRejectsUnknownFormula(t *testing.T) {
+	if _, err := newDamageModel(DamageConfig{Formula: "quadratic"}); err == nil {
+		t.Error("newDamageModel() accepted an unknown formula")
+	}
+}
+
+func TestUnitCritFromTemplates(t *testing.T) {
+	templates := defaultGameTemplates()
+	templates.Troops[3].CritMultiplier = 2.5 // Knight
+	templates.Towers[0].CritMultiplier = 1.8 // King Tower
+	m := &Match{templates: templates}
+
+	tests := []struct {
+		name           string
+		crit           func() (float64, float64)
+		wantChance     float64
+		wantMultiplier float64
+	}{
+		{"troop with its own multiplier", func() (float64, float64) { return m.troopCrit(&Troop{Name: "Knight"}) }, 0.05, 2.5},
+		{"troop using the default", func() (float64, float64) { return m.troopCrit(&Troop{Name: "Pawn"}) }, 0.05, 0},
+		{"support troop", func() (float64, float64) { return m.troopCrit(&Troop{Name: "Queen"}) }, 0, 0},
+		{"troop missing from the templates", func() (float64, float64) { return m.troopCrit(&Troop{Name: "Dragon", ATK: 500}) }, 0, 0},
+		{"tower with its own multiplier", func() (float64, float64) { return m.towerCrit(&Tower{Type: "King Tower"}) }, 0.1, 1.8},
+		{"tower using the default", func() (float64, float64) { return m.towerCrit(&Tower{Type: "Guard Tower", CRIT: 0.9}) }, 0.05, 0},
+		{"tower missing from the templates", func() (float64, float64) { return m.towerCrit(&Tower{Type: "Wall", CRIT: 0.2}) }, 0.2, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chance, multiplier := tt.crit()
+			if chance != tt.wantChance || multiplier != tt.wantMultiplier {
+				t.Errorf("crit = (%g, %g), want (%g, %g)", chance, multiplier, tt.wantChance, tt.wantMultiplier)
+			}
+		})
+	}
+}
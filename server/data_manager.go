@@ -4,12 +4,13 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"math/rand"
 	"os"
+	"strings"
 )
 
 // PlayerStorage handles player data persistence
 type PlayerStorage struct {
+	Version int                    `json:"version"` // schema version, see migrate.go
 	Players map[string]*PlayerData `json:"players"`
 }
 
@@ -21,7 +22,20 @@ type TroopTemplate struct {
 	DEF     float64 `json:"def"`
 	MANA    float64 `json:"mana"`
 	EXP     float64 `json:"exp"`
-	Special string  `json:"special"`
+	Special string  `json:"special"` // description; generated from the abilities when empty
+
+	CRIT           float64 `json:"crit"`
+	CritMultiplier float64 `json:"crit_multiplier,omitempty"`
+
+	Abilities []Ability `json:"abilities,omitempty"`
+}
+
+// description returns the troop's special text
+func (t *TroopTemplate) description() string {
+	if t.Special != "" {
+		return t.Special
+	}
+	return describeAbilities(t.Abilities)
 }
 
 // TowerTemplate defines tower specifications
@@ -32,68 +46,105 @@ type TowerTemplate struct {
 	DEF  float64 `json:"def"`
 	CRIT float64 `json:"crit"`
 	EXP  float64 `json:"exp"`
+
+	CritMultiplier float64 `json:"crit_multiplier,omitempty"`
 }
 
 // GameTemplates stores all game specifications
 type GameTemplates struct {
-	Troops []TroopTemplate `json:"troops"`
-	Towers []TowerTemplate `json:"towers"`
+	Version int             `json:"version"` // schema version, see migrate.go
+	Troops  []TroopTemplate `json:"troops"`
+	Towers  []TowerTemplate `json:"towers"`
+	Damage  DamageConfig    `json:"damage"`
+	Rules   RulesConfig     `json:"rules"`
 }
 
-// initializeDefaultData creates default JSON files if they don't exist
-func initializeDefaultData() {
-	// Initialize player data file
-	if _, err := os.Stat("players.json"); os.IsNotExist(err) {
-		createDefaultPlayersFile()
+// troop returns the template for a troop name, or nil
+func (t *GameTemplates) troop(name string) *TroopTemplate {
+	for i := range t.Troops {
+		if t.Troops[i].Name == name {
+			return &t.Troops[i]
+		}
 	}
+	return nil
+}
 
-	// Initialize game templates file
-	if _, err := os.Stat("game_templates.json"); os.IsNotExist(err) {
-		createDefaultTemplatesFile()
+// tower returns the template for a tower type, or nil
+func (t *GameTemplates) tower(towerType string) *TowerTemplate {
+	for i := range t.Towers {
+		if t.Towers[i].Type == towerType {
+			return &t.Towers[i]
+		}
 	}
+	return nil
 }
 
-// createDefaultPlayersFile creates the initial players.json
-func createDefaultPlayersFile() {
-	storage := &PlayerStorage{
-		Players: make(map[string]*PlayerData),
+// initializeDefaultData creates the default templates file and test accounts if missing
+func initializeDefaultData(store PlayerStore) {
+	// Templates first: new accounts are built from them
+	if _, err := os.Stat(templatesFile); os.IsNotExist(err) {
+		createDefaultTemplatesFile()
 	}
 
-	// Create default test players
-	player1 := createNewPlayer("player1", "password1")
-	player2 := createNewPlayer("player2", "password2")
-
-	storage.Players["player1"] = player1
-	storage.Players["player2"] = player2
+	// Seed an empty store with test accounts
+	if names, err := store.List(); err == nil && len(names) == 0 {
+		templates, err := loadGameTemplates()
+		if err != nil {
+			fmt.Printf("Error loading templates, no test accounts created: %v\n", err)
+			return
+		}
+		createDefaultPlayers(store, templates)
+	}
+}
 
-	savePlayerStorage(storage)
-	fmt.Println("Created default players.json with test accounts")
+// createDefaultPlayers stores the initial test accounts
+func createDefaultPlayers(store PlayerStore, templates *GameTemplates) {
+	for i := 1; i <= 2; i++ {
+		player := createNewPlayer(fmt.Sprintf("player%d", i), fmt.Sprintf("password%d", i), templates)
+		if player == nil {
+			continue
+		}
+		if err := store.Put(player); err != nil {
+			fmt.Printf("Error creating test account %s: %v\n", player.Username, err)
+		}
+	}
+	fmt.Println("Created default test accounts")
 }
 
-// createDefaultTemplatesFile creates the game_templates.json
-func createDefaultTemplatesFile() {
-	templates := &GameTemplates{
+// defaultGameTemplates returns the balance data a new server starts with
+func defaultGameTemplates() *GameTemplates {
+	return &GameTemplates{
+		Version: templatesSchemaVersion,
 		Troops: []TroopTemplate{
-			{Name: "Pawn", HP: 50, ATK: 150, DEF: 100, MANA: 3, EXP: 5, Special: ""},
-			{Name: "Bishop", HP: 100, ATK: 200, DEF: 150, MANA: 4, EXP: 10, Special: ""},
-			{Name: "Rook", HP: 250, ATK: 200, DEF: 200, MANA: 5, EXP: 25, Special: ""},
-			{Name: "Knight", HP: 200, ATK: 300, DEF: 150, MANA: 5, EXP: 25, Special: ""},
-			{Name: "Prince", HP: 500, ATK: 400, DEF: 300, MANA: 6, EXP: 50, Special: ""},
-			{Name: "Queen", HP: 99, ATK: 0, DEF: 0, MANA: 5, EXP: 30, Special: "Heal 300 to lowest HP tower"},
+			{Name: "Pawn", HP: 50, ATK: 150, DEF: 100, MANA: 3, EXP: 5, Special: "", CRIT: 0.05},
+			{Name: "Bishop", HP: 100, ATK: 200, DEF: 150, MANA: 4, EXP: 10, Special: "", CRIT: 0.05},
+			{Name: "Rook", HP: 250, ATK: 200, DEF: 200, MANA: 5, EXP: 25, Special: "", CRIT: 0.05},
+			{Name: "Knight", HP: 200, ATK: 300, DEF: 150, MANA: 5, EXP: 25, Special: "", CRIT: 0.05},
+			{Name: "Prince", HP: 500, ATK: 400, DEF: 300, MANA: 6, EXP: 50, Special: "", CRIT: 0.05},
+			{Name: "Queen", HP: 99, ATK: 0, DEF: 0, MANA: 5, EXP: 30,
+				Abilities: []Ability{{Effect: EffectHealLowest, Amount: 300}}},
 		},
 		Towers: []TowerTemplate{
 			{Type: "King Tower", HP: 2000, ATK: 500, DEF: 300, CRIT: 0.1, EXP: 200},
 			{Type: "Guard Tower", HP: 1000, ATK: 300, DEF: 100, CRIT: 0.05, EXP: 100},
 		},
+		Damage: DamageConfig{
+			Formula:        defaultDamageFormula,
+			MinDamage:      0,
+			CritMultiplier: defaultCritMultiplier,
+		},
 	}
+}
 
-	data, err := json.MarshalIndent(templates, "", "  ")
+// createDefaultTemplatesFile creates the game_templates.json
+func createDefaultTemplatesFile() {
+	data, err := json.MarshalIndent(defaultGameTemplates(), "", "  ")
 	if err != nil {
 		fmt.Printf("Error marshaling templates: %v\n", err)
 		return
 	}
 
-	err = os.WriteFile("game_templates.json", data, 0644)
+	err = writeFileAtomic(templatesFile, data, 0644)
 	if err != nil {
 		fmt.Printf("Error writing templates file: %v\n", err)
 		return
@@ -102,95 +153,128 @@ func createDefaultTemplatesFile() {
 	fmt.Println("Created default game_templates.json")
 }
 
-// loadPlayerStorage loads all player data from JSON
-func loadPlayerStorage() *PlayerStorage {
-	data, err := os.ReadFile("players.json")
+// authenticatePlayer verifies player credentials and returns player data
+func (s *Server) authenticatePlayer(username, password string) (*PlayerData, error) {
+	player, err := s.store.Get(username)
+	if err == errPlayerNotFound {
+		return nil, errNoSuchAccount
+	}
 	if err != nil {
-		fmt.Printf("Error reading players file: %v\n", err)
-		return &PlayerStorage{Players: make(map[string]*PlayerData)}
+		fmt.Printf("Error loading player %s: %v\n", username, err)
+		return nil, fmt.Errorf("could not load your account, please try again later")
 	}
 
-	var storage PlayerStorage
-	err = json.Unmarshal(data, &storage)
-	if err != nil {
-		fmt.Printf("Error unmarshaling players: %v\n", err)
-		return &PlayerStorage{Players: make(map[string]*PlayerData)}
+	ok, needsUpgrade := verifyPassword(player.Password, password)
+	if !ok {
+		return nil, errWrongPassword
 	}
 
-	return &storage
-}
+	// Transparently replace legacy plaintext (or weaker) hashes
+	if needsUpgrade {
+		hashed, err := hashPassword(password)
+		if err != nil {
+			fmt.Printf("Error hashing password for %s: %v\n", username, err)
+			return player, nil
+		}
 
-// savePlayerStorage saves all player data to JSON
-func savePlayerStorage(storage *PlayerStorage) {
-	data, err := json.MarshalIndent(storage, "", "  ")
-	if err != nil {
-		fmt.Printf("Error marshaling player storage: %v\n", err)
-		return
-	}
+		err = s.store.Update(username, func(stored *PlayerData) error {
+			stored.Password = hashed
+			return nil
+		})
+		if err != nil {
+			fmt.Printf("Error saving upgraded password for %s: %v\n", username, err)
+			return player, nil
+		}
+		player.Password = hashed
 
-	err = os.WriteFile("players.json", data, 0644)
-	if err != nil {
-		fmt.Printf("Error writing players file: %v\n", err)
+		s.dataMux.Lock()
+		if cached, exists := s.playerData[username]; exists {
+			cached.Password = hashed
+		}
+		s.dataMux.Unlock()
+
+		fmt.Printf("Upgraded stored password for player: %s\n", username)
 	}
+
+	return player, nil
 }
 
-// loadGameTemplates loads troop and tower specifications
-func loadGameTemplates() *GameTemplates {
-	data, err := os.ReadFile("game_templates.json")
-	if err != nil {
-		fmt.Printf("Error reading templates file: %v\n", err)
-		return nil
-	}
+// playerExists reports whether an account with exactly this username exists
+func (s *Server) playerExists(username string) bool {
+	_, err := s.store.Get(username)
+	return err == nil
+}
 
-	var templates GameTemplates
-	err = json.Unmarshal(data, &templates)
+// accountExists reports whether a username is taken, ignoring case
+func (s *Server) accountExists(username string) bool {
+	names, err := s.store.List()
 	if err != nil {
-		fmt.Printf("Error unmarshaling templates: %v\n", err)
-		return nil
+		fmt.Printf("Error listing players: %v\n", err)
+		return true // refuse the name rather than risk a duplicate
 	}
-
-	return &templates
+	for _, name := range names {
+		if strings.EqualFold(name, username) {
+			return true
+		}
+	}
+	return false
 }
 
-// authenticatePlayer verifies player credentials and returns player data
-func (s *Server) authenticatePlayer(username, password string) *PlayerData {
-	storage := loadPlayerStorage()
-
-	player, exists := storage.Players[username]
-	if !exists {
-		// Create new player if doesn't exist
-		player = createNewPlayer(username, password)
-		storage.Players[username] = player
-		savePlayerStorage(storage)
-		fmt.Printf("Created new player: %s\n", username)
-		return player
+// registerPlayer creates and stores a new account
+func (s *Server) registerPlayer(username, password string) (*PlayerData, error) {
+	// Hashing is deliberately slow, so do it before taking any lock
+	player := createNewPlayer(username, password, s.currentTemplates())
+	if player == nil {
+		return nil, fmt.Errorf("could not create account, please try again later")
 	}
 
-	if player.Password != password {
-		return nil
+	// Serialize registrations so two clients can't claim the same name.
+	// This lock is separate from dataMux so logins and saves aren't held up.
+	s.registerMux.Lock()
+	defer s.registerMux.Unlock()
+
+	if s.accountExists(username) {
+		return nil, errAccountExists
 	}
 
-	return player
+	if err := s.store.Put(player); err != nil {
+		fmt.Printf("Error saving new player %s: %v\n", username, err)
+		return nil, fmt.Errorf("could not create account, please try again later")
+	}
+	s.ratings.update(player)
+	fmt.Printf("Created new player: %s\n", username)
+	return player, nil
 }
 
 // createNewPlayer creates a new player with default stats
-func createNewPlayer(username, password string) *PlayerData {
-	templates := loadGameTemplates()
-	if templates == nil {
-		fmt.Println("Warning: Could not load game templates")
+func createNewPlayer(username, password string, templates *GameTemplates) *PlayerData {
+
+	hashed, err := hashPassword(password)
+	if err != nil {
+		fmt.Printf("Error hashing password: %v\n", err)
 		return nil
 	}
 
 	player := &PlayerData{
 		Username: username,
-		Password: password,
+		Password: hashed,
 		EXP:      0,
 		Level:    1,
-		Towers:   make(map[string]*Tower),
+		Rating:   defaultRating,
+		Towers:   defaultTowers(templates),
 		Troops:   make([]*Troop, 0),
 	}
 
-	// Create towers
+	// Unlock the full collection and start with a random deck
+	syncCollection(player, templates)
+	player.Deck = randomDeck(player, newRand(newSeed()))
+
+	return player
+}
+
+// defaultTowers creates level 1 towers for every position from the templates
+func defaultTowers(templates *GameTemplates) map[string]*Tower {
+	towers := make(map[string]*Tower)
 	for _, towerTemplate := range templates.Towers {
 		var position string
 		if towerTemplate.Type == "King Tower" {
@@ -206,11 +290,11 @@ func createNewPlayer(username, password string) *PlayerData {
 					ATK:      towerTemplate.ATK,
 					DEF:      towerTemplate.DEF,
 					CRIT:     towerTemplate.CRIT,
-					EXP:      towerTemplate.EXP,
+					EXP:      0,
 					Level:    1,
 					Position: pos,
 				}
-				player.Towers[pos] = tower
+				towers[pos] = tower
 			}
 			continue
 		}
@@ -223,67 +307,60 @@ func createNewPlayer(username, password string) *PlayerData {
 				ATK:      towerTemplate.ATK,
 				DEF:      towerTemplate.DEF,
 				CRIT:     towerTemplate.CRIT,
-				EXP:      towerTemplate.EXP,
+				EXP:      0,
 				Level:    1,
 				Position: position,
 			}
-			player.Towers[position] = tower
-		}
-	}
-
-	// Randomly select 3 troops
-	selectedTroops := make(map[int]bool)
-	for len(player.Troops) < 3 {
-		idx := rand.Intn(len(templates.Troops))
-		if !selectedTroops[idx] {
-			selectedTroops[idx] = true
-			troopTemplate := templates.Troops[idx]
-
-			troop := &Troop{
-				Name:    troopTemplate.Name,
-				HP:      troopTemplate.HP,
-				MaxHP:   troopTemplate.HP,
-				ATK:     troopTemplate.ATK,
-				DEF:     troopTemplate.DEF,
-				MANA:    troopTemplate.MANA,
-				EXP:     troopTemplate.EXP,
-				Level:   1,
-				Special: troopTemplate.Special,
-			}
-			player.Troops = append(player.Troops, troop)
+			towers[position] = tower
 		}
 	}
-
-	return player
+	return towers
 }
 
 // loadPlayerData loads specific player data
 func (s *Server) loadPlayerData(username string) *PlayerData {
-	s.dataMux.RLock()
-	defer s.dataMux.RUnlock()
+	s.dataMux.Lock()
+	defer s.dataMux.Unlock()
 
 	if player, exists := s.playerData[username]; exists {
 		return player
 	}
 
-	// Load from file if not in memory
-	storage := loadPlayerStorage()
-	if player, exists := storage.Players[username]; exists {
-		s.playerData[username] = player
-		return player
+	// Load from the store if not in memory
+	player, err := s.store.Get(username)
+	if err != nil {
+		if err != errPlayerNotFound {
+			fmt.Printf("Error loading player %s: %v\n", username, err)
+		}
+		return nil
 	}
-
-	return nil
+	templates := s.currentTemplates()
+	if syncCollection(player, templates) {
+		if err := s.store.Put(player); err != nil {
+			fmt.Printf("Error saving player %s: %v\n", username, err)
+		}
+	}
+	// Show current balance in decks even before a match applies it
+	applyTemplates(player, templates)
+	s.playerData[username] = player
+	return player
 }
 
 // savePlayerData saves specific player data
 func (s *Server) savePlayerData(username string, player *PlayerData) {
 	s.dataMux.Lock()
 	s.playerData[username] = player
+	// Snapshot under dataMux, which guards the fields other commands update
+	// in the cache (such as the mute list)
+	stored, err := copyPlayer(player)
 	s.dataMux.Unlock()
+	if err != nil {
+		fmt.Printf("Error saving player %s: %v\n", username, err)
+		return
+	}
+	s.ratings.update(stored)
 
-	// Save to file
-	storage := loadPlayerStorage()
-	storage.Players[username] = player
-	savePlayerStorage(storage)
+	if err := s.store.Put(stored); err != nil {
+		fmt.Printf("Error saving player %s: %v\n", username, err)
+	}
 }
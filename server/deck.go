@@ -0,0 +1,215 @@
+// deck.go
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// deckSize is the number of troops a player brings into a match
+const deckSize = 3
+
+// newTroopFromTemplate creates a level 1 troop card
+func newTroopFromTemplate(template TroopTemplate) *Troop {
+	return &Troop{
+		Name:    template.Name,
+		HP:      template.HP,
+		MaxHP:   template.HP,
+		ATK:     template.ATK,
+		DEF:     template.DEF,
+		MANA:    template.MANA,
+		EXP:     0,
+		Level:   1,
+		Special: template.description(),
+	}
+}
+
+// syncCollection unlocks every template troop the player does not own yet and
+// gives accounts from before deck building their original troops as a deck.
+// It reports whether the player data changed.
+func syncCollection(player *PlayerData, templates *GameTemplates) bool {
+	changed := false
+
+	if len(player.Deck) == 0 {
+		for _, troop := range player.Troops {
+			if len(player.Deck) < deckSize {
+				player.Deck = append(player.Deck, troop.Name)
+				changed = true
+			}
+		}
+	}
+
+	if templates != nil {
+		for _, template := range templates.Troops {
+			if player.card(template.Name) == nil {
+				player.Troops = append(player.Troops, newTroopFromTemplate(template))
+				changed = true
+			}
+		}
+	}
+
+	return changed
+}
+
+// card returns the player's troop card with the given name (case-insensitive), or nil
+func (p *PlayerData) card(name string) *Troop {
+	for _, troop := range p.Troops {
+		if strings.EqualFold(troop.Name, name) {
+			return troop
+		}
+	}
+	return nil
+}
+
+// validateDeck checks the deck size, duplicates and ownership of every card
+func validateDeck(player *PlayerData, deck []string) error {
+	if len(deck) != deckSize {
+		return fmt.Errorf("a deck must contain exactly %d troops (has %d)", deckSize, len(deck))
+	}
+
+	seen := make(map[string]bool)
+	for _, name := range deck {
+		key := strings.ToLower(name)
+		if seen[key] {
+			return fmt.Errorf("%s is in the deck more than once", name)
+		}
+		seen[key] = true
+
+		if player.card(name) == nil {
+			return fmt.Errorf("%s is not in your collection", name)
+		}
+	}
+	return nil
+}
+
+// deckTroops resolves the player's deck to their troop cards
+func deckTroops(player *PlayerData) []*Troop {
+	troops := make([]*Troop, 0, len(player.Deck))
+	for _, name := range player.Deck {
+		if troop := player.card(name); troop != nil {
+			troops = append(troops, troop)
+		}
+	}
+	return troops
+}
+
+// randomDeck picks deckSize distinct troop names from the collection using rng
+func randomDeck(player *PlayerData, rng *rand.Rand) []string {
+	names := make([]string, 0, len(player.Troops))
+	for _, troop := range player.Troops {
+		names = append(names, troop.Name)
+	}
+	rng.Shuffle(len(names), func(i, j int) {
+		names[i], names[j] = names[j], names[i]
+	})
+	if len(names) > deckSize {
+		names = names[:deckSize]
+	}
+	return names
+}
+
+// handleDeckCommand processes "deck show", "deck set" and "deck swap"
+func (s *Server) handleDeckCommand(client *Client, args []string) {
+	player := s.loadPlayerData(client.Username)
+	if player == nil {
+		client.SendError("❌ Could not load your player data.\n")
+		return
+	}
+
+	match, _ := client.Match()
+	inMatch := match != nil && match.isActive()
+
+	if len(args) == 0 || args[0] == "show" {
+		if !inMatch {
+			// Reflect template reloads since the player was loaded
+			applyTemplates(player, s.currentTemplates())
+		}
+		s.showDeck(client, player)
+		return
+	}
+
+	if inMatch {
+		client.SendError("❌ You cannot change your deck during a match.\n")
+		return
+	}
+
+	var deck []string
+	switch args[0] {
+	case "set":
+		if len(args) != deckSize+1 {
+			client.SendError(fmt.Sprintf("Usage: deck set <troop1> ... <troop%d>\n", deckSize))
+			return
+		}
+		for _, name := range args[1:] {
+			if troop := player.card(name); troop != nil {
+				name = troop.Name
+			}
+			deck = append(deck, name)
+		}
+
+	case "swap":
+		if len(args) != 3 {
+			client.SendError("Usage: deck swap <slot> <troop>\n")
+			return
+		}
+		slot, err := strconv.Atoi(args[1])
+		if err != nil || slot < 1 || slot > len(player.Deck) {
+			client.SendError(fmt.Sprintf("❌ Invalid deck slot. Use 1-%d.\n", len(player.Deck)))
+			return
+		}
+		troop := player.card(args[2])
+		if troop == nil {
+			client.SendError(fmt.Sprintf("❌ %s is not in your collection.\n", args[2]))
+			return
+		}
+
+		deck = append(deck, player.Deck...)
+		// Swapping in a troop that is already in the deck exchanges the two slots
+		for i, name := range deck {
+			if strings.EqualFold(name, troop.Name) {
+				deck[i] = deck[slot-1]
+			}
+		}
+		deck[slot-1] = troop.Name
+
+	default:
+		client.SendError("Usage: deck [show | set <troops...> | swap <slot> <troop>]\n")
+		return
+	}
+
+	if err := validateDeck(player, deck); err != nil {
+		client.SendError(fmt.Sprintf("❌ %s\n", capitalize(err.Error())))
+		return
+	}
+
+	player.Deck = deck
+	s.savePlayerData(player.Username, player)
+	client.Send("✅ Deck updated!\n")
+	s.showDeck(client, player)
+}
+
+// showDeck displays the player's deck and collection
+func (s *Server) showDeck(client *Client, player *PlayerData) {
+	output := "\n╔═══════════════ 🃏 YOUR DECK 🃏 ═══════════════╗\n"
+	for i, troop := range deckTroops(player) {
+		output += fmt.Sprintf("║ %d. %-8s Lv%-2d HP %4.0f ATK %4.0f DEF %4.0f MANA %2.0f ║\n",
+			i+1, troop.Name, troop.Level, troop.MaxHP, troop.ATK, troop.DEF, troop.MANA)
+	}
+	output += "╠═══════════════ 📚 COLLECTION ════════════════╣\n"
+	for _, troop := range player.Troops {
+		output += fmt.Sprintf("║ • %-8s Lv%-2d HP %4.0f ATK %4.0f DEF %4.0f MANA %2.0f ║\n",
+			troop.Name, troop.Level, troop.MaxHP, troop.ATK, troop.DEF, troop.MANA)
+		if troop.Special != "" {
+			output += fmt.Sprintf("║    ✨ Special: %-32s ║\n", troop.Special)
+		}
+	}
+	output += "╚══════════════════════════════════════════════╝\n"
+	output += "💡 deck set <troop1> <troop2> <troop3> | deck swap <slot> <troop>\n"
+
+	client.SendEvent(MsgDeck, DeckMessage{
+		Deck:       player.Deck,
+		Collection: player.Troops,
+	}, output)
+}
@@ -3,19 +3,18 @@ package main
 
 import (
 	"fmt"
-	"math/rand"
-	"net"
+	"math"
 	"strings"
 	"time"
 )
 
 // displayGameState shows current game status to player
-func (s *Server) displayGameState(conn net.Conn, playerNum int) {
-	s.gameStateMux.RLock()
-	defer s.gameStateMux.RUnlock()
+func (m *Match) displayGameState(c *Client, playerNum int) {
+	m.stateMux.RLock()
+	defer m.stateMux.RUnlock()
 
-	if s.gameState == nil {
-		conn.Write([]byte("❌ Game not started yet.\n"))
+	if m.state == nil {
+		c.SendError("❌ Game not started yet.\n")
 		return
 	}
 
@@ -23,40 +22,47 @@ func (s *Server) displayGameState(conn net.Conn, playerNum int) {
 	var playerMana, opponentMana float64
 
 	if playerNum == 1 {
-		player = s.gameState.Player1
-		opponent = s.gameState.Player2
-		playerMana = s.gameState.Player1Mana
-		opponentMana = s.gameState.Player2Mana
+		player = m.state.Player1
+		opponent = m.state.Player2
+		playerMana = m.state.Player1Mana
+		opponentMana = m.state.Player2Mana
 	} else {
-		player = s.gameState.Player2
-		opponent = s.gameState.Player1
-		playerMana = s.gameState.Player2Mana
-		opponentMana = s.gameState.Player1Mana
+		player = m.state.Player2
+		opponent = m.state.Player1
+		playerMana = m.state.Player2Mana
+		opponentMana = m.state.Player1Mana
 	}
 
 	output := fmt.Sprintf("\n╔═══════════════ 🎮 GAME STATUS 🎮 ═══════════════╗\n")
 
 	// HIỂN THỊ LƯỢT CHƠI
 	var turnStatus string
-	if s.gameState.Turn == playerNum {
+	if m.mode == ModeRealTime {
+		turnStatus = "⚡ REAL-TIME - Attack when you have mana!"
+	} else if m.state.Turn == playerNum {
 		turnStatus = "🟢 YOUR TURN - You can attack!"
 	} else {
 		var waitingFor string
-		if s.gameState.Turn == 1 {
-			waitingFor = s.gameState.Player1.Username
+		if m.state.Turn == 1 {
+			waitingFor = m.state.Player1.Username
 		} else {
-			waitingFor = s.gameState.Player2.Username
+			waitingFor = m.state.Player2.Username
 		}
 		turnStatus = fmt.Sprintf("🔴 %s's TURN - Please wait", waitingFor)
 	}
 	output += fmt.Sprintf("║ Turn: %-45s ║\n", turnStatus)
+	if m.hasTurnClock() && m.state.IsGameActive {
+		output += fmt.Sprintf("║ ⏱️ Turn clock: %-33s ║\n", fmt.Sprintf("%d seconds left", m.turnLeft))
+	}
 	output += fmt.Sprintf("╠═══════════════════════════════════════════════════╣\n")
 
 	output += fmt.Sprintf("║ 💧 Your Mana: %-8.0f/10 | Opponent: %-8.0f/10 ║\n", playerMana, opponentMana)
+	spectators := m.spectatorCount()
+	output += fmt.Sprintf("║ 👀 Spectators: %-34d ║\n", spectators)
 
-	if s.gameState.IsGameActive {
-		elapsed := time.Since(s.gameState.GameStartTime).Seconds()
-		remaining := float64(s.gameState.GameDuration) - elapsed
+	if m.state.IsGameActive {
+		elapsed := time.Since(m.state.GameStartTime).Seconds()
+		remaining := float64(m.state.GameDuration) - elapsed
 		if remaining > 0 {
 			output += fmt.Sprintf("║ ⏰ Time Remaining: %-27.0f seconds ║\n", remaining)
 		} else {
@@ -67,10 +73,16 @@ func (s *Server) displayGameState(conn net.Conn, playerNum int) {
 	output += fmt.Sprintf("╠═══════════════════════════════════════════════════╣\n")
 	output += fmt.Sprintf("║ 🏰 YOUR TOWERS:                                   ║\n")
 
-	for pos, tower := range player.Towers {
+	for _, pos := range towerPositions {
+		tower := player.Towers[pos]
+		if tower == nil {
+			continue
+		}
 		status := "🟢 ALIVE"
 		if tower.HP <= 0 {
 			status = "💥 DESTROYED"
+		} else if tower.Shield > 0 {
+			status = fmt.Sprintf("🛡️ %.0f", tower.Shield)
 		}
 		hpPercent := (tower.HP / tower.MaxHP) * 100
 		output += fmt.Sprintf("║ %-12s (%s): HP %4.0f/%4.0f (%3.0f%%) [%s] ║\n",
@@ -80,10 +92,16 @@ func (s *Server) displayGameState(conn net.Conn, playerNum int) {
 	output += fmt.Sprintf("╠═══════════════════════════════════════════════════╣\n")
 	output += fmt.Sprintf("║ 🏰 OPPONENT TOWERS:                               ║\n")
 
-	for pos, tower := range opponent.Towers {
+	for _, pos := range towerPositions {
+		tower := opponent.Towers[pos]
+		if tower == nil {
+			continue
+		}
 		status := "🟢 ALIVE"
 		if tower.HP <= 0 {
 			status = "💥 DESTROYED"
+		} else if tower.Shield > 0 {
+			status = fmt.Sprintf("🛡️ %.0f", tower.Shield)
 		}
 		hpPercent := (tower.HP / tower.MaxHP) * 100
 		output += fmt.Sprintf("║ %-12s (%s): HP %4.0f/%4.0f (%3.0f%%) [%s] ║\n",
@@ -93,9 +111,12 @@ func (s *Server) displayGameState(conn net.Conn, playerNum int) {
 	output += fmt.Sprintf("╠═══════════════════════════════════════════════════╣\n")
 	output += fmt.Sprintf("║ ⚔️ YOUR TROOPS:                                    ║\n")
 
-	for i, troop := range player.Troops {
+	for i, troop := range m.deck(playerNum) {
 		output += fmt.Sprintf("║ %d. %-8s: HP %3.0f, ATK %3.0f, DEF %3.0f, MANA %3.0f ║\n",
 			i+1, troop.Name, troop.HP, troop.ATK, troop.DEF, troop.MANA)
+		if troop.HP <= 0 {
+			output += fmt.Sprintf("║    %-46s ║\n", "💀 Knocked out")
+		}
 		if troop.Special != "" {
 			output += fmt.Sprintf("║    ✨ Special: %-35s ║\n", troop.Special)
 		}
@@ -103,7 +124,7 @@ func (s *Server) displayGameState(conn net.Conn, playerNum int) {
 
 	output += fmt.Sprintf("╚═══════════════════════════════════════════════════╝\n")
 
-	if s.gameState.Turn == playerNum {
+	if m.hasTurn(playerNum) {
 		// Determine valid target based on current tower status
 		var nextTarget string
 		guard1 := opponent.Towers["guard1"]
@@ -118,26 +139,51 @@ func (s *Server) displayGameState(conn net.Conn, playerNum int) {
 			nextTarget = "king"
 		}
 
-		output += fmt.Sprintf("💡 Your turn! Use: attack <1-3> %s\n", nextTarget)
+		if m.mode == ModeRealTime {
+			output += fmt.Sprintf("💡 Attack any time! Use: attack <1-3> %s\n", nextTarget)
+		} else {
+			output += fmt.Sprintf("💡 Your turn! Use: attack <1-3> %s\n", nextTarget)
+		}
 		output += fmt.Sprintf("🎯 Attack order: Guard1 → Guard2 → King\n")
 	}
 
-	conn.Write([]byte(output))
+	status := GameStatusMessage{
+		MatchID:        m.ID,
+		Opponent:       opponent.Username,
+		IsGameActive:   m.state.IsGameActive,
+		Mode:           m.mode,
+		YourTurn:       m.hasTurn(playerNum),
+		PlayerMana:     playerMana,
+		OpponentMana:   opponentMana,
+		PlayerTowers:   player.Towers,
+		OpponentTowers: opponent.Towers,
+		PlayerTroops:   m.deck(playerNum),
+		Spectators:     spectators,
+	}
+	if m.hasTurnClock() {
+		status.TurnTimeLeft = m.turnLeft
+	}
+	if m.state.IsGameActive {
+		status.TimeRemaining = math.Max(0, float64(m.state.GameDuration)-time.Since(m.state.GameStartTime).Seconds())
+	}
+
+	c.SendEvent(MsgStatus, status, output)
 }
 
 // processAttack handles troop attacks with turn-based system
-func (s *Server) processAttackWithTurns(conn net.Conn, playerNum int, troopIndex int, targetType string) {
-	s.gameStateMux.Lock()
-	defer s.gameStateMux.Unlock()
+func (m *Match) processAttackWithTurns(c *Client, playerNum int, troopIndex int, targetType string) {
+	m.stateMux.Lock()
+	defer m.stateMux.Unlock()
 
-	if s.gameState == nil || !s.gameState.IsGameActive {
-		conn.Write([]byte("❌ Game not active.\n"))
+	if m.state == nil || !m.state.IsGameActive {
+		c.SendError("❌ Game not active.\n")
 		return
 	}
+	m.record(ReplayCommand, playerNum, fmt.Sprintf("attack %d %s", troopIndex+1, targetType))
 
 	// Double check turn
-	if s.gameState.Turn != playerNum {
-		conn.Write([]byte("❌ Not your turn!\n"))
+	if !m.hasTurn(playerNum) {
+		c.SendError("❌ Not your turn!\n")
 		return
 	}
 
@@ -146,201 +192,273 @@ func (s *Server) processAttackWithTurns(conn net.Conn, playerNum int, troopIndex
 	var attackerName, defenderName string
 
 	if playerNum == 1 {
-		attacker = s.gameState.Player1
-		defender = s.gameState.Player2
-		attackerMana = &s.gameState.Player1Mana
+		attacker = m.state.Player1
+		defender = m.state.Player2
+		attackerMana = &m.state.Player1Mana
 		attackerName = attacker.Username
 		defenderName = defender.Username
 	} else {
-		attacker = s.gameState.Player2
-		defender = s.gameState.Player1
-		attackerMana = &s.gameState.Player2Mana
+		attacker = m.state.Player2
+		defender = m.state.Player1
+		attackerMana = &m.state.Player2Mana
 		attackerName = attacker.Username
 		defenderName = defender.Username
 	}
 
-	if troopIndex < 0 || troopIndex >= len(attacker.Troops) {
-		conn.Write([]byte("❌ Invalid troop selection.\n"))
+	if troopIndex < 0 || troopIndex >= len(m.deck(playerNum)) {
+		c.SendError("❌ Invalid troop selection.\n")
 		return
 	}
 
-	troop := attacker.Troops[troopIndex]
+	troop := m.deck(playerNum)[troopIndex]
+
+	if troop.HP <= 0 {
+		c.SendError(fmt.Sprintf("❌ %s was knocked out and cannot be deployed this match.\n", troop.Name))
+		return
+	}
 
 	// Check mana
 	if *attackerMana < troop.MANA {
-		conn.Write([]byte(fmt.Sprintf("❌ Not enough mana! Need %.0f, have %.0f\n",
-			troop.MANA, *attackerMana)))
+		c.SendError(fmt.Sprintf("❌ Not enough mana! Need %.0f, have %.0f\n",
+			troop.MANA, *attackerMana))
 		return
 	}
 
-	// Deduct mana
-	*attackerMana -= troop.MANA
+	ctx := &abilityContext{
+		playerNum:    playerNum,
+		troop:        troop,
+		attacker:     attacker,
+		defender:     defender,
+		attackerName: attackerName,
+		defenderName: defenderName,
+	}
 
-	// Handle special abilities
-	if troop.Name == "Queen" {
-		s.handleQueenSpecial(conn, attacker, attackerName)
-		s.switchTurn() // Queen cũng tốn lượt
+	// Support troops without attack only cast their deploy effects
+	if troop.ATK <= 0 {
+		*attackerMana -= troop.MANA
+		m.takeAction(playerNum)
+		m.resolveAbilities(onDeploy, ctx)
+		if m.state.IsGameActive && m.mode == ModeTurnBased {
+			m.switchTurn() // casting also uses the turn
+		}
 		return
 	}
 
 	// Find and validate target
-	targetTower := s.findTargetTower(defender, targetType)
+	targetTower := m.findTargetTower(defender, targetType)
 	if targetTower == nil {
-		conn.Write([]byte("❌ Invalid target or target already destroyed.\n"))
+		c.SendError("❌ Invalid target or target already destroyed.\n")
 		return
 	}
 
 	// Validate attack rules
-	if !s.canAttackTarget(defender, targetTower, conn) {
+	if !m.canAttackTarget(defender, targetTower, c) {
 		return
 	}
 
-	// Store original HP to check if tower was destroyed
-	originalHP := targetTower.HP
-
-	// Calculate and apply damage
-	damage := s.calculateDamage(troop.ATK, targetTower.DEF, 0.05)
-	targetTower.HP -= damage
+	// Only a valid attack costs mana and counts as the player's move
+	*attackerMana -= troop.MANA
+	m.takeAction(playerNum)
 
-	if targetTower.HP < 0 {
-		targetTower.HP = 0
+	m.resolveAbilities(onDeploy, ctx)
+	if !m.state.IsGameActive {
+		return
 	}
 
+	// Calculate and apply damage; the troop earns EXP for the damage it
+	// dealt and any tower it destroyed
+	critChance, critMultiplier := m.troopCrit(troop)
+	damage, crit := m.calculateDamage(troop.ATK, targetTower.DEF, critChance, critMultiplier)
+	_, absorbed, towerDestroyed := m.damageTower(playerNum, troop, targetTower, damage)
+
 	// Send attack results
-	s.sendAttackResults(conn, troop, targetTower, damage, attackerName, defenderName)
+	m.sendAttackResults(c, troop, targetTower, damage, crit, attackerName, defenderName)
+	if absorbed > 0 {
+		m.broadcastToAll(fmt.Sprintf("🛡️ The shield absorbed %.0f damage.\n", absorbed))
+	}
 
-	// Check if tower was destroyed
-	towerDestroyed := (originalHP > 0 && targetTower.HP <= 0)
+	if towerDestroyed {
+		m.handleTowerDestruction(targetTower, playerNum, attackerName, defenderName)
+	}
+	if m.state.IsGameActive {
+		ctx.target = targetTower
+		ctx.damage = damage
+		m.resolveAbilities(onHit, ctx)
+	}
 
 	if towerDestroyed {
-		s.handleTowerDestruction(targetTower, playerNum, attackerName, defenderName)
+		if !m.state.IsGameActive || m.mode == ModeRealTime {
+			return
+		}
 
 		// BONUS TURN: Nếu tiêu diệt tháp thì được chơi tiếp
-		s.broadcastToAll(fmt.Sprintf("🔥 %s destroyed a tower and gets another turn!\n", attackerName))
+		m.broadcastToAll(fmt.Sprintf("🔥 %s destroyed a tower and gets another turn!\n", attackerName))
+		m.resetTurnClock()
 		// Không switch turn, player này tiếp tục được chơi
 	} else {
+		if !m.state.IsGameActive {
+			return
+		}
+
+		// Surviving towers strike back at the attacking troop
+		m.towerCounterattack(targetTower, troop, attackerName, defenderName)
+
+		if !m.state.IsGameActive || m.mode == ModeRealTime {
+			return
+		}
+
 		// Chuyển lượt cho người chơi khác
-		s.switchTurn()
+		m.switchTurn()
+	}
+}
+
+// towerCounterattack lets a surviving tower retaliate against the attacking troop
+func (m *Match) towerCounterattack(tower *Tower, troop *Troop, attackerName, defenderName string) {
+	critChance, critMultiplier := m.towerCrit(tower)
+	damage, crit := m.calculateDamage(tower.ATK, troop.DEF, critChance, critMultiplier)
+	troop.HP -= damage
+	if troop.HP < 0 {
+		troop.HP = 0
+	}
+
+	knockedOut := troop.HP <= 0
+	message := ""
+	if crit {
+		message += "💥 CRITICAL HIT! "
+	}
+	message += fmt.Sprintf("🏹 %s's %s strikes back at %s's %s for %.0f damage! HP: %.0f/%.0f\n",
+		defenderName, tower.Type, attackerName, troop.Name, damage, troop.HP, troop.MaxHP)
+	if knockedOut {
+		message += fmt.Sprintf("💀 %s's %s was knocked out!\n", attackerName, troop.Name)
+	}
+
+	m.broadcastEvent(MsgCounterattack, CounterattackMessage{
+		Owner:      defenderName,
+		Tower:      tower.Position,
+		Troop:      troop.Name,
+		TroopOwner: attackerName,
+		Damage:     damage,
+		Crit:       crit,
+		TroopHP:    troop.HP,
+		TroopMaxHP: troop.MaxHP,
+		KnockedOut: knockedOut,
+	}, message)
+
+	// With every troop knocked out on both sides nobody can attack anymore
+	if knockedOut && !m.hasStandingTroops(1) && !m.hasStandingTroops(2) {
+		m.endByTowerCount(EndNoTroops, "💀 All troops have been knocked out!")
+	}
+}
+
+// hasStandingTroops reports whether the player still has a troop that can be deployed
+func (m *Match) hasStandingTroops(playerNum int) bool {
+	for _, troop := range m.deck(playerNum) {
+		if troop.HP > 0 {
+			return true
+		}
 	}
+	return false
 }
 
 // switchTurn changes the current player's turn
-func (s *Server) switchTurn() {
-	if s.gameState.Turn == 1 {
-		s.gameState.Turn = 2
-		s.broadcastToAll(fmt.Sprintf("🔄 It's %s's turn now!\n", s.gameState.Player2.Username))
+func (m *Match) switchTurn() {
+	var next *PlayerData
+	if m.state.Turn == 1 {
+		m.state.Turn = 2
+		next = m.state.Player2
 	} else {
-		s.gameState.Turn = 1
-		s.broadcastToAll(fmt.Sprintf("🔄 It's %s's turn now!\n", s.gameState.Player1.Username))
+		m.state.Turn = 1
+		next = m.state.Player1
 	}
+
+	// A player without standing troops cannot act; the turn goes straight back
+	if !m.hasStandingTroops(m.state.Turn) {
+		m.broadcastToAll(fmt.Sprintf("💀 %s has no troops left and skips their turn.\n", next.Username))
+		if m.state.Turn == 1 {
+			m.state.Turn = 2
+			next = m.state.Player2
+		} else {
+			m.state.Turn = 1
+			next = m.state.Player1
+		}
+	}
+
+	m.resetTurnClock()
+	m.broadcastEvent(MsgTurn, TurnMessage{Turn: m.state.Turn, Username: next.Username},
+		fmt.Sprintf("🔄 It's %s's turn now!\n", next.Username))
 }
 
 // isPlayerTurn checks if it's the player's turn
-func (s *Server) isPlayerTurn(playerNum int) bool {
-	s.gameStateMux.RLock()
-	defer s.gameStateMux.RUnlock()
+func (m *Match) isPlayerTurn(playerNum int) bool {
+	m.stateMux.RLock()
+	defer m.stateMux.RUnlock()
 
-	if s.gameState == nil || !s.gameState.IsGameActive {
+	if m.state == nil || !m.state.IsGameActive {
 		return false
 	}
 
-	return s.gameState.Turn == playerNum
+	return m.hasTurn(playerNum)
+}
+
+// hasTurn reports whether the player may act now; in real-time mode both always can.
+// Caller must hold stateMux.
+func (m *Match) hasTurn(playerNum int) bool {
+	return m.mode == ModeRealTime || m.state.Turn == playerNum
 }
 
 // notifyNotYourTurn informs player it's not their turn
-func (s *Server) notifyNotYourTurn(conn net.Conn, playerNum int) {
-	s.gameStateMux.RLock()
-	defer s.gameStateMux.RUnlock()
+func (m *Match) notifyNotYourTurn(c *Client, playerNum int) {
+	m.stateMux.RLock()
+	defer m.stateMux.RUnlock()
 
-	if s.gameState == nil {
-		conn.Write([]byte("❌ Game not started.\n"))
+	if m.state == nil {
+		c.SendError("❌ Game not started.\n")
+		return
+	}
+	if !m.state.IsGameActive {
+		c.SendError("❌ Game is not active.\n")
 		return
 	}
 
 	var waitingFor string
-	if s.gameState.Turn == 1 {
-		waitingFor = s.gameState.Player1.Username
+	if m.state.Turn == 1 {
+		waitingFor = m.state.Player1.Username
 	} else {
-		waitingFor = s.gameState.Player2.Username
-	}
-
-	conn.Write([]byte(fmt.Sprintf("⏳ Not your turn! Waiting for %s to play.\n", waitingFor)))
-}
-
-// handleQueenSpecial processes Queen's healing ability
-func (s *Server) handleQueenSpecial(conn net.Conn, player *PlayerData, playerName string) {
-	var lowestTower *Tower
-	lowestHP := float64(99999)
-
-	for _, tower := range player.Towers {
-		if tower.HP > 0 && tower.HP < lowestHP {
-			lowestHP = tower.HP
-			lowestTower = tower
-		}
+		waitingFor = m.state.Player2.Username
 	}
 
-	if lowestTower != nil {
-		healAmount := 300.0
-		oldHP := lowestTower.HP
-		lowestTower.HP += healAmount
-		if lowestTower.HP > lowestTower.MaxHP {
-			lowestTower.HP = lowestTower.MaxHP
-		}
-
-		actualHeal := lowestTower.HP - oldHP
-		message := fmt.Sprintf("👑 Queen healed %s for %.0f HP! (%.0f -> %.0f)\n",
-			lowestTower.Type, actualHeal, oldHP, lowestTower.HP)
-		conn.Write([]byte(message))
-
-		s.broadcastToOthers(conn, fmt.Sprintf("🔮 %s's Queen healed their %s!\n",
-			playerName, lowestTower.Type))
-	} else {
-		conn.Write([]byte("👑 Queen found no towers to heal.\n"))
-	}
+	c.Send(fmt.Sprintf("⏳ Not your turn! Waiting for %s to play.\n", waitingFor))
 }
 
 // findTargetTower locates the target tower (no smart targeting)
-func (s *Server) findTargetTower(defender *PlayerData, targetType string) *Tower {
-	for pos, tower := range defender.Towers {
-		if tower.HP <= 0 {
+func (m *Match) findTargetTower(defender *PlayerData, targetType string) *Tower {
+	for _, pos := range towerPositions {
+		tower := defender.Towers[pos]
+		if tower == nil || tower.HP <= 0 {
 			continue // Skip destroyed towers
 		}
 
-		switch targetType {
-		case "king":
-			if pos == "king" {
-				return tower
-			}
-		case "guard1":
-			if pos == "guard1" {
-				return tower
-			}
-		case "guard2":
-			if pos == "guard2" {
-				return tower
-			}
-		case "guard":
-			// BỎ SMART TARGETING - chỉ tìm guard1 hoặc guard2 có sẵn
-			if pos == "guard1" || pos == "guard2" {
-				return tower
-			}
+		// "guard" means the first standing guard in attack order
+		if pos == targetType || (targetType == "guard" && pos != "king") {
+			return tower
 		}
 	}
 	return nil
 }
 
 // canAttackTarget validates attack rules with detailed messages
-func (s *Server) canAttackTarget(defender *PlayerData, target *Tower, conn net.Conn) bool {
+func (m *Match) canAttackTarget(defender *PlayerData, target *Tower, c *Client) bool {
 	// RULE 1: Phải tiêu diệt guard1 trước khi tấn công guard2
 	if target.Type == "Guard Tower" && target.Position == "guard2" {
 		guard1 := defender.Towers["guard1"]
 		if guard1 != nil && guard1.HP > 0 {
-			conn.Write([]byte("🚫 INVALID TARGET! 🚫\n"))
-			conn.Write([]byte("❌ Must destroy Guard Tower 1 before attacking Guard Tower 2!\n"))
-			conn.Write([]byte(fmt.Sprintf("🏰 Guard1 HP: %.0f/%.0f (still alive)\n", guard1.HP, guard1.MaxHP)))
-			conn.Write([]byte("💡 Try: attack <1-3> guard1\n"))
-			conn.Write([]byte("🎯 Attack order: Guard1 → Guard2 → King\n"))
-			conn.Write([]byte("⚡ You can attack again this turn!\n\n"))
+			message := "🚫 INVALID TARGET! 🚫\n"
+			message += "❌ Must destroy Guard Tower 1 before attacking Guard Tower 2!\n"
+			message += fmt.Sprintf("🏰 Guard1 HP: %.0f/%.0f (still alive)\n", guard1.HP, guard1.MaxHP)
+			message += "💡 Try: attack <1-3> guard1\n"
+			message += "🎯 Attack order: Guard1 → Guard2 → King\n"
+			message += "⚡ You can attack again this turn!\n\n"
+			c.SendError(message)
 			return false
 		}
 	}
@@ -348,26 +466,27 @@ func (s *Server) canAttackTarget(defender *PlayerData, target *Tower, conn net.C
 	// RULE 2: Phải tiêu diệt tất cả Guard Towers trước khi tấn công King
 	if target.Type == "King Tower" {
 		var aliveGuards []string
-		for pos, tower := range defender.Towers {
-			if (pos == "guard1" || pos == "guard2") && tower.HP > 0 {
+		for _, pos := range towerPositions {
+			if tower := defender.Towers[pos]; tower != nil && pos != "king" && tower.HP > 0 {
 				aliveGuards = append(aliveGuards, fmt.Sprintf("%s (%.0f HP)", pos, tower.HP))
 			}
 		}
 
 		if len(aliveGuards) > 0 {
-			conn.Write([]byte("🚫 INVALID TARGET! 🚫\n"))
-			conn.Write([]byte("❌ Must destroy all Guard Towers before attacking King Tower!\n"))
-			conn.Write([]byte(fmt.Sprintf("🏰 Remaining guards: %s\n", strings.Join(aliveGuards, ", "))))
+			message := "🚫 INVALID TARGET! 🚫\n"
+			message += "❌ Must destroy all Guard Towers before attacking King Tower!\n"
+			message += fmt.Sprintf("🏰 Remaining guards: %s\n", strings.Join(aliveGuards, ", "))
 
 			// Suggest next target
 			if defender.Towers["guard1"] != nil && defender.Towers["guard1"].HP > 0 {
-				conn.Write([]byte("💡 Try: attack <1-3> guard1\n"))
+				message += "💡 Try: attack <1-3> guard1\n"
 			} else if defender.Towers["guard2"] != nil && defender.Towers["guard2"].HP > 0 {
-				conn.Write([]byte("💡 Try: attack <1-3> guard2\n"))
+				message += "💡 Try: attack <1-3> guard2\n"
 			}
 
-			conn.Write([]byte("🎯 Attack order: Guard1 → Guard2 → King\n"))
-			conn.Write([]byte("⚡ You can attack again this turn!\n\n"))
+			message += "🎯 Attack order: Guard1 → Guard2 → King\n"
+			message += "⚡ You can attack again this turn!\n\n"
+			c.SendError(message)
 			return false
 		}
 	}
@@ -376,189 +495,238 @@ func (s *Server) canAttackTarget(defender *PlayerData, target *Tower, conn net.C
 }
 
 // sendAttackResults notifies players of attack outcome
-func (s *Server) sendAttackResults(conn net.Conn, troop *Troop, target *Tower,
-	damage float64, attackerName, defenderName string) {
+func (m *Match) sendAttackResults(c *Client, troop *Troop, target *Tower,
+	damage float64, crit bool, attackerName, defenderName string) {
 
-	message := fmt.Sprintf("⚔️ %s attacked %s for %.0f damage!\n",
-		troop.Name, target.Type, damage)
+	critText := ""
+	if crit {
+		critText = "💥 CRITICAL HIT! "
+	}
+
+	message := fmt.Sprintf("%s⚔️ %s attacked %s for %.0f damage!\n",
+		critText, troop.Name, target.Type, damage)
 	message += fmt.Sprintf("🎯 Target HP: %.0f/%.0f\n", target.HP, target.MaxHP)
 
-	conn.Write([]byte(message))
+	result := AttackResultMessage{
+		Attacker:    attackerName,
+		Defender:    defenderName,
+		Troop:       troop.Name,
+		Target:      target.Position,
+		Damage:      damage,
+		Crit:        crit,
+		TargetHP:    target.HP,
+		TargetMaxHP: target.MaxHP,
+	}
+
+	c.SendEvent(MsgAttackResult, result, message)
+
+	m.broadcastEventToOthers(c, MsgAttackResult, result,
+		fmt.Sprintf("%s🚨 %s's %s attacked your %s for %.0f damage! HP: %.0f/%.0f\n",
+			critText, attackerName, troop.Name, target.Type, damage, target.HP, target.MaxHP))
 
-	s.broadcastToOthers(conn,
-		fmt.Sprintf("🚨 %s's %s attacked your %s for %.0f damage! HP: %.0f/%.0f\n",
-			attackerName, troop.Name, target.Type, damage, target.HP, target.MaxHP))
+	m.broadcastToSpectators(MsgAttackResult, result,
+		fmt.Sprintf("%s⚔️ %s's %s attacked %s's %s for %.0f damage! HP: %.0f/%.0f\n",
+			critText, attackerName, troop.Name, defenderName, target.Type, damage, target.HP, target.MaxHP))
 }
 
 // handleTowerDestruction manages tower destruction and win conditions
-func (s *Server) handleTowerDestruction(tower *Tower, winnerNum int, attackerName, defenderName string) {
+func (m *Match) handleTowerDestruction(tower *Tower, winnerNum int, attackerName, defenderName string) {
+	m.towersDestroyed[winnerNum-1]++
+
 	destructionMsg := fmt.Sprintf("💥 %s DESTROYED!\n", tower.Type)
-	s.broadcastToAll(destructionMsg)
+	m.broadcastEvent(MsgTowerDown, TowerDestroyedMessage{
+		Owner:    defenderName,
+		Tower:    tower.Type,
+		Position: tower.Position,
+	}, destructionMsg)
 
 	if tower.Type == "King Tower" {
-		s.endGame(winnerNum, fmt.Sprintf("👑 %s wins by destroying the King Tower!", attackerName))
+		m.endGame(winnerNum, EndKingDestroyed, fmt.Sprintf("👑 %s wins by destroying the King Tower!", attackerName))
 	}
 }
 
-// calculateDamage computes damage with critical hit chance
-func (s *Server) calculateDamage(atkStat, defStat, critChance float64) float64 {
-	damage := atkStat
-
-	// Apply critical hit
-	if rand.Float64() < critChance {
-		damage *= 1.2
-	}
+// calculateDamage computes damage with the match's damage model
+func (m *Match) calculateDamage(atkStat, defStat, critChance, critMultiplier float64) (float64, bool) {
+	return m.damage.Compute(m.rng, atkStat, defStat, critChance, critMultiplier)
+}
 
-	// Apply defense
-	damage = damage - defStat
-	if damage < 0 {
-		damage = 0
+// troopCrit returns a troop's crit chance and multiplier from the templates
+func (m *Match) troopCrit(troop *Troop) (float64, float64) {
+	if template := m.templates.troop(troop.Name); template != nil {
+		return template.CRIT, template.CritMultiplier
 	}
-
-	return damage
+	return 0, 0
 }
 
-// startManaRegeneration begins mana regeneration system
-func (s *Server) startManaRegeneration() {
-	ticker := time.NewTicker(time.Second)
-	go func() {
-		defer ticker.Stop()
-		for range ticker.C {
-			s.gameStateMux.Lock()
-			if s.gameState != nil && s.gameState.IsGameActive {
-				if s.gameState.Player1Mana < 10 {
-					s.gameState.Player1Mana++
-				}
-				if s.gameState.Player2Mana < 10 {
-					s.gameState.Player2Mana++
-				}
-			} else {
-				s.gameStateMux.Unlock()
-				return
-			}
-			s.gameStateMux.Unlock()
-		}
-	}()
+// towerCrit returns a tower's crit chance and multiplier from the templates
+func (m *Match) towerCrit(tower *Tower) (float64, float64) {
+	if template := m.templates.tower(tower.Type); template != nil {
+		return template.CRIT, template.CritMultiplier
+	}
+	return tower.CRIT, 0
 }
 
-// startGameTimer manages game duration and timeout
-func (s *Server) startGameTimer() {
-	go func() {
-		time.Sleep(time.Duration(s.gameState.GameDuration) * time.Second)
-
-		s.gameStateMux.Lock()
-		defer s.gameStateMux.Unlock()
+// regenerateMana gives both players one mana per second, up to 10
+func (m *Match) regenerateMana() {
+	m.stateMux.Lock()
+	defer m.stateMux.Unlock()
 
-		if s.gameState != nil && s.gameState.IsGameActive {
-			s.handleGameTimeout()
-		}
-	}()
+	if m.state == nil || !m.state.IsGameActive {
+		return
+	}
+	m.record(ReplayTick, 0, "")
+	if m.state.Player1Mana < maxMana {
+		m.state.Player1Mana++
+	}
+	if m.state.Player2Mana < maxMana {
+		m.state.Player2Mana++
+	}
+	m.tickBurns()
+	m.tickTurnClock()
 }
 
 // handleGameTimeout processes game end by timeout
-func (s *Server) handleGameTimeout() {
+func (m *Match) handleGameTimeout() {
+	m.endByTowerCount(EndTimeout, "⏰ Time's up!")
+}
+
+// endByTowerCount ends the game in favour of the player with more surviving towers
+func (m *Match) endByTowerCount(reason, message string) {
 	// Count surviving towers
 	p1Towers := 0
 	p2Towers := 0
 
-	for _, tower := range s.gameState.Player1.Towers {
+	for _, tower := range orderedTowers(m.state.Player1) {
 		if tower.HP > 0 {
 			p1Towers++
 		}
 	}
 
-	for _, tower := range s.gameState.Player2.Towers {
+	for _, tower := range orderedTowers(m.state.Player2) {
 		if tower.HP > 0 {
 			p2Towers++
 		}
 	}
 
 	if p1Towers > p2Towers {
-		s.endGame(1, fmt.Sprintf("⏰ Time's up! %s wins with %d towers remaining!",
-			s.gameState.Player1.Username, p1Towers))
+		m.endGame(1, reason, fmt.Sprintf("%s %s wins with %d towers remaining!",
+			message, m.state.Player1.Username, p1Towers))
 	} else if p2Towers > p1Towers {
-		s.endGame(2, fmt.Sprintf("⏰ Time's up! %s wins with %d towers remaining!",
-			s.gameState.Player2.Username, p2Towers))
+		m.endGame(2, reason, fmt.Sprintf("%s %s wins with %d towers remaining!",
+			message, m.state.Player2.Username, p2Towers))
 	} else {
-		s.endGameDraw()
+		m.endGameDraw(reason, fmt.Sprintf("%s Both players have %d towers remaining.", message, p1Towers))
 	}
 }
 
 // endGame handles game completion with winner
-func (s *Server) endGame(winnerNum int, message string) {
-	s.gameState.IsGameActive = false
+func (m *Match) endGame(winnerNum int, reason, message string) {
+	m.state.IsGameActive = false
+	m.finish()
+	ratingSummary, ratingChanges := m.applyRatings(winnerNum)
+	m.recordHistory(winnerNum, reason)
 
 	var winner, loser *PlayerData
 	if winnerNum == 1 {
-		winner = s.gameState.Player1
-		loser = s.gameState.Player2
+		winner = m.state.Player1
+		loser = m.state.Player2
 	} else {
-		winner = s.gameState.Player2
-		loser = s.gameState.Player1
+		winner = m.state.Player2
+		loser = m.state.Player1
 	}
 
-	// Award EXP
-	winner.EXP += 30
-
-	// Check for level ups
-	s.checkLevelUp(winner)
-	s.checkLevelUp(loser)
-
-	// Save player data
-	s.savePlayerData(winner.Username, winner)
-	s.savePlayerData(loser.Username, loser)
-
 	// Announce results
-	s.broadcastToAll(fmt.Sprintf("\n🎉 GAME OVER! 🎉\n%s\n", message))
-	s.broadcastToAll(fmt.Sprintf("🏆 %s gained 30 EXP!\n", winner.Username))
-	s.broadcastToAll("Type 'quit' to leave or wait for next game.\n")
+	announcement := fmt.Sprintf("\n🎉 GAME OVER! 🎉\n%s\n", message)
+
+	var levelUps []UnitLevelUpMessage
+	if m.practice {
+		announcement += practiceNote
+	} else {
+		// Award EXP
+		winner.EXP += 30
+
+		// Check for level ups
+		m.checkLevelUp(winner)
+		m.checkLevelUp(loser)
+		var progression string
+		progression, levelUps = m.applyUnitProgression()
+
+		m.savePlayers()
+
+		announcement += fmt.Sprintf("🏆 %s gained 30 EXP!\n", winner.Username)
+		announcement += ratingSummary
+		announcement += progression
+	}
+
+	announcement += "Type 'play' to find a new match or 'quit' to leave.\n"
+	m.broadcastEvent(MsgGameOver, GameOverMessage{
+		Winner:        winner.Username,
+		Loser:         loser.Username,
+		Message:       message,
+		LevelUps:      levelUps,
+		RatingChanges: ratingChanges,
+	}, announcement)
 }
 
 // endGameDraw handles draw games
-func (s *Server) endGameDraw() {
-	s.gameState.IsGameActive = false
-
-	// Award EXP for draw
-	s.gameState.Player1.EXP += 10
-	s.gameState.Player2.EXP += 10
-
-	s.checkLevelUp(s.gameState.Player1)
-	s.checkLevelUp(s.gameState.Player2)
+func (m *Match) endGameDraw(reason, message string) {
+	m.state.IsGameActive = false
+	m.finish()
+	ratingSummary, ratingChanges := m.applyRatings(0)
+	m.recordHistory(0, reason)
+
+	announcement := "\n🤝 GAME OVER - IT'S A DRAW! 🤝\n"
+	announcement += message + "\n"
+
+	var levelUps []UnitLevelUpMessage
+	if m.practice {
+		announcement += practiceNote
+	} else {
+		// Award EXP for draw
+		m.state.Player1.EXP += 10
+		m.state.Player2.EXP += 10
+
+		m.checkLevelUp(m.state.Player1)
+		m.checkLevelUp(m.state.Player2)
+		var progression string
+		progression, levelUps = m.applyUnitProgression()
+
+		m.savePlayers()
+
+		announcement += "Both players gained 10 EXP!\n"
+		announcement += ratingSummary
+		announcement += progression
+	}
+	announcement += "Type 'play' to find a new match or 'quit' to leave.\n"
+	m.broadcastEvent(MsgGameOver, GameOverMessage{
+		Draw:          true,
+		Message:       message,
+		LevelUps:      levelUps,
+		RatingChanges: ratingChanges,
+	}, announcement)
+}
 
-	s.savePlayerData(s.gameState.Player1.Username, s.gameState.Player1)
-	s.savePlayerData(s.gameState.Player2.Username, s.gameState.Player2)
+// practiceNote ends the game over announcement of a practice match
+const practiceNote = "🤖 Practice match: no EXP or rating changes.\n"
 
-	s.broadcastToAll("\n🤝 GAME OVER - IT'S A DRAW! 🤝\n")
-	s.broadcastToAll("Both players gained 10 EXP!\n")
-	s.broadcastToAll("Type 'quit' to leave or wait for next game.\n")
+// savePlayers persists both players' progress; replays never touch saved data
+func (m *Match) savePlayers() {
+	if m.playback {
+		return
+	}
+	m.server.savePlayerData(m.state.Player1.Username, m.state.Player1)
+	m.server.savePlayerData(m.state.Player2.Username, m.state.Player2)
 }
 
-// checkLevelUp handles player leveling system
-func (s *Server) checkLevelUp(player *PlayerData) {
+// checkLevelUp handles player leveling system; units level on their own
+func (m *Match) checkLevelUp(player *PlayerData) {
 	requiredEXP := 100.0 * (1.1 * float64(player.Level))
 
 	for player.EXP >= requiredEXP {
 		player.EXP -= requiredEXP
 		player.Level++
 
-		// Increase stats by 10%
-		for _, tower := range player.Towers {
-			tower.HP *= 1.1
-			tower.MaxHP *= 1.1
-			tower.ATK *= 1.1
-			tower.DEF *= 1.1
-			tower.Level = player.Level
-		}
-
-		for _, troop := range player.Troops {
-			troop.HP *= 1.1
-			troop.MaxHP *= 1.1
-			troop.ATK *= 1.1
-			troop.DEF *= 1.1
-			troop.Level = player.Level
-		}
-
-		s.broadcastToAll(fmt.Sprintf("🎊 %s leveled up to Level %d!\n",
+		m.broadcastToAll(fmt.Sprintf("🎊 %s leveled up to Level %d!\n",
 			player.Username, player.Level))
 
 		requiredEXP = 100.0 * (1.1 * float64(player.Level))
@@ -0,0 +1,322 @@
+// history.go
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// How a match ended
+const (
+	EndKingDestroyed = "king"        // a King Tower fell
+	EndTimeout       = "timeout"     // the clock ran out; most towers standing wins
+	EndNoTroops      = "no_troops"   // every troop was knocked out; most towers standing wins
+	EndDisconnect    = "disconnect"  // a player did not reconnect in time
+	EndIdle          = "idle"        // a player let the turn clock run out too often in a row
+	EndSurrender     = "surrender"   // a player resigned
+	EndDrawAgreed    = "draw_agreed" // both players agreed to a draw
+)
+
+const (
+	historyFile  = "match_history.jsonl"
+	historyLimit = 10 // matches shown by "history"
+)
+
+// MatchRecord is the stored outcome of one finished match
+type MatchRecord struct {
+	MatchID         string                        `json:"match_id"`
+	Mode            string                        `json:"mode"`
+	Player1         string                        `json:"player1"`
+	Player2         string                        `json:"player2"`
+	Winner          string                        `json:"winner,omitempty"`
+	Loser           string                        `json:"loser,omitempty"`
+	Draw            bool                          `json:"draw"`
+	Reason          string                        `json:"reason"`
+	StartedAt       time.Time                     `json:"started_at"`
+	EndedAt         time.Time                     `json:"ended_at"`
+	Duration        float64                       `json:"duration_seconds"`
+	TowersDestroyed map[string]int                `json:"towers_destroyed"` // by username
+	Damage          map[string]map[string]float64 `json:"damage"`           // username -> troop -> damage dealt
+	Ranked          bool                          `json:"ranked"`
+	RatingChange    map[string]float64            `json:"rating_change,omitempty"`
+}
+
+// opponentOf returns the other player of the match
+func (r *MatchRecord) opponentOf(username string) string {
+	if r.Player1 == username {
+		return r.Player2
+	}
+	return r.Player1
+}
+
+// resultFor returns "WIN", "LOSS" or "DRAW" from a player's point of view
+func (r *MatchRecord) resultFor(username string) string {
+	switch {
+	case r.Draw:
+		return "DRAW"
+	case r.Winner == username:
+		return "WIN"
+	default:
+		return "LOSS"
+	}
+}
+
+// MatchHistory appends finished matches to a JSON-lines file
+type MatchHistory struct {
+	path string
+	mux  sync.Mutex
+}
+
+// NewMatchHistory opens the history store at path; the file is created on first write
+func NewMatchHistory(path string) *MatchHistory {
+	return &MatchHistory{path: path}
+}
+
+// append writes one finished match to the end of the history file
+func (h *MatchHistory) append(record *MatchRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	file, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+// forPlayer returns a player's matches, newest first; limit 0 returns all of them
+func (h *MatchHistory) forPlayer(username string, limit int) ([]*MatchRecord, error) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	file, err := os.Open(h.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []*MatchRecord
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var record MatchRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue // skip a torn line rather than lose the whole history
+		}
+		if record.Player1 == username || record.Player2 == username {
+			records = append(records, &record)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// Newest first
+	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+		records[i], records[j] = records[j], records[i]
+	}
+	if limit > 0 && len(records) > limit {
+		records = records[:limit]
+	}
+	return records, nil
+}
+
+// recordHistory stores the outcome of the match, after ratings were applied.
+// Caller must hold stateMux.
+func (m *Match) recordHistory(winnerNum int, reason string) {
+	if m.playback || m.practice {
+		return
+	}
+
+	p1, p2 := m.state.Player1.Username, m.state.Player2.Username
+	now := time.Now()
+	record := &MatchRecord{
+		MatchID:         m.ID,
+		Mode:            m.mode,
+		Player1:         p1,
+		Player2:         p2,
+		Draw:            winnerNum == 0,
+		Reason:          reason,
+		StartedAt:       m.state.GameStartTime,
+		EndedAt:         now,
+		Duration:        now.Sub(m.state.GameStartTime).Seconds(),
+		TowersDestroyed: map[string]int{p1: m.towersDestroyed[0], p2: m.towersDestroyed[1]},
+		Damage:          map[string]map[string]float64{p1: m.damageDealt[0], p2: m.damageDealt[1]},
+	}
+	if m.ranked {
+		record.Ranked = true
+		record.RatingChange = map[string]float64{p1: m.ratingChange[0], p2: m.ratingChange[1]}
+	}
+	switch winnerNum {
+	case 1:
+		record.Winner, record.Loser = p1, p2
+	case 2:
+		record.Winner, record.Loser = p2, p1
+	}
+
+	if err := m.server.history.append(record); err != nil {
+		fmt.Printf("Error saving history of match #%s: %v\n", m.ID, err)
+	}
+}
+
+// PlayerStats summarizes a player's match history
+type PlayerStats struct {
+	Username      string  `json:"username"`
+	Rating        float64 `json:"rating"`
+	Games         int     `json:"games"`
+	Wins          int     `json:"wins"`
+	Losses        int     `json:"losses"`
+	Draws         int     `json:"draws"`
+	WinRate       float64 `json:"win_rate"`       // percent
+	AverageDamage float64 `json:"average_damage"` // per match
+	FavoriteTroop string  `json:"favorite_troop,omitempty"`
+}
+
+// computeStats summarizes a player's matches. The favorite troop is the one
+// brought into battle in the most matches, then the one with most damage.
+func computeStats(username string, records []*MatchRecord) PlayerStats {
+	stats := PlayerStats{Username: username, Games: len(records)}
+	totalDamage := 0.0
+	troopGames := make(map[string]int)
+	troopDamage := make(map[string]float64)
+
+	for _, record := range records {
+		switch record.resultFor(username) {
+		case "WIN":
+			stats.Wins++
+		case "LOSS":
+			stats.Losses++
+		default:
+			stats.Draws++
+		}
+
+		for troop, damage := range record.Damage[username] {
+			totalDamage += damage
+			troopGames[troop]++
+			troopDamage[troop] += damage
+		}
+	}
+
+	if stats.Games > 0 {
+		stats.WinRate = float64(stats.Wins) / float64(stats.Games) * 100
+		stats.AverageDamage = totalDamage / float64(stats.Games)
+	}
+
+	troops := make([]string, 0, len(troopGames))
+	for troop := range troopGames {
+		troops = append(troops, troop)
+	}
+	sort.Slice(troops, func(i, j int) bool {
+		a, b := troops[i], troops[j]
+		if troopGames[a] != troopGames[b] {
+			return troopGames[a] > troopGames[b]
+		}
+		if troopDamage[a] != troopDamage[b] {
+			return troopDamage[a] > troopDamage[b]
+		}
+		return a < b
+	})
+	if len(troops) > 0 {
+		stats.FavoriteTroop = troops[0]
+	}
+	return stats
+}
+
+// endReasonName returns the display text of an end reason
+func endReasonName(reason string) string {
+	switch reason {
+	case EndKingDestroyed:
+		return "King Tower destroyed"
+	case EndTimeout:
+		return "time's up"
+	case EndNoTroops:
+		return "all troops knocked out"
+	case EndDisconnect:
+		return "disconnect"
+	case EndIdle:
+		return "turn clock forfeit"
+	case EndSurrender:
+		return "surrender"
+	case EndDrawAgreed:
+		return "draw agreed"
+	}
+	return reason
+}
+
+// showHistory lists the client's most recent matches
+func (s *Server) showHistory(client *Client) {
+	records, err := s.history.forPlayer(client.Username, historyLimit)
+	if err != nil {
+		client.SendError(fmt.Sprintf("❌ Could not read match history: %v\n", err))
+		return
+	}
+
+	output := "\n📜 MATCH HISTORY\n"
+	if len(records) == 0 {
+		output += "No matches played yet. Type 'play' to start!\n"
+	}
+	for _, record := range records {
+		result := record.resultFor(client.Username)
+		icon := map[string]string{"WIN": "🏆", "LOSS": "💔", "DRAW": "🤝"}[result]
+		opponent := record.opponentOf(client.Username)
+		output += fmt.Sprintf("#%s %s %s vs %s - %s, %s, towers destroyed %d-%d (%s)\n",
+			record.MatchID, icon, result, opponent, endReasonName(record.Reason), formatDuration(record.Duration),
+			record.TowersDestroyed[client.Username], record.TowersDestroyed[opponent],
+			record.EndedAt.Format("2006-01-02 15:04"))
+	}
+
+	client.SendEvent(MsgHistory, HistoryMessage{Username: client.Username, Matches: records}, output)
+}
+
+// showStats shows a player's win rate, average damage and favorite troop
+func (s *Server) showStats(client *Client, username string) {
+	if !s.playerExists(username) {
+		client.SendError(fmt.Sprintf("❌ No such player '%s'.\n", username))
+		return
+	}
+
+	records, err := s.history.forPlayer(username, 0)
+	if err != nil {
+		client.SendError(fmt.Sprintf("❌ Could not read match history: %v\n", err))
+		return
+	}
+	stats := computeStats(username, records)
+	// The cached player may be in a match that is updating its rating
+	stats.Rating = s.ratings.rating(username)
+
+	favorite := stats.FavoriteTroop
+	if favorite == "" {
+		favorite = "-"
+	}
+
+	output := fmt.Sprintf("\n📊 STATS for %s\n", username)
+	output += fmt.Sprintf("📈 Rating: %.0f\n", stats.Rating)
+	output += fmt.Sprintf("🎮 Matches: %d (%d W / %d L / %d D)\n", stats.Games, stats.Wins, stats.Losses, stats.Draws)
+	output += fmt.Sprintf("🏆 Win rate: %.1f%%\n", stats.WinRate)
+	output += fmt.Sprintf("⚔️ Average damage per match: %.0f\n", stats.AverageDamage)
+	output += fmt.Sprintf("⭐ Favorite troop: %s\n", favorite)
+
+	client.SendEvent(MsgStats, stats, output)
+}
+
+// formatDuration renders seconds as m:ss
+func formatDuration(seconds float64) string {
+	total := int(seconds)
+	return fmt.Sprintf("%d:%02d", total/60, total%60)
+}
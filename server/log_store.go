@@ -0,0 +1,445 @@
+// log_store.go
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Compaction thresholds for the log store
+const (
+	compactMinSize = 1 << 20 // logs smaller than this are never compacted
+	compactRatio   = 2       // compact once the log is this many times the live data
+)
+
+// logBaseSchemaVersion is the players schema of records written before
+// records carried a version. The log store has always held current players,
+// and the schema was at v3 when versions were added.
+const logBaseSchemaVersion = 3
+
+// logRecord is one line of the append-only log
+type logRecord struct {
+	Op      string      `json:"op"` // "put" or "del"
+	Key     string      `json:"key"`
+	Version int         `json:"version,omitempty"` // players schema of Player, see migrate.go
+	Player  *PlayerData `json:"player,omitempty"`
+}
+
+// logEntry locates the latest record of a key in the log file
+type logEntry struct {
+	offset  int64
+	length  int64
+	version int // players schema the record was written with
+}
+
+// logStore is an embedded key-value store: every change is appended to the
+// log and an in-memory index points at each player's latest record, so a
+// write costs one small append instead of rewriting every account. The log
+// is compacted once stale records dominate it.
+type logStore struct {
+	path       string
+	file       *os.File
+	index      map[string]logEntry
+	size       int64 // bytes in the log
+	live       int64 // bytes of records still referenced by the index
+	lastBackup time.Time
+	mux        sync.Mutex
+}
+
+// openLogStore opens (or creates) the log at path. A new, empty log imports
+// the players of importFrom, the JSON file used by the json backend.
+func openLogStore(path, importFrom string) (*logStore, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %v", path, err)
+	}
+
+	ls := &logStore{path: path, file: file, index: make(map[string]logEntry), lastBackup: time.Now()}
+	if err := ls.load(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if ls.size == 0 && importFrom != "" {
+		if err := ls.importJSON(importFrom); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	if err := ls.migrate(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if err := ls.maybeCompact(); err != nil {
+		log.Printf("Log store: compaction failed: %v", err)
+	}
+	return ls, nil
+}
+
+// load replays the log to rebuild the index. A torn final record, left by a
+// crash in the middle of an append, is cut off; damage anywhere else is an error.
+func (ls *logStore) load() error {
+	if _, err := ls.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(ls.file)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				log.Printf("Log store: dropping incomplete record at offset %d of %s", offset, ls.path)
+				if err := ls.file.Truncate(offset); err != nil {
+					return err
+				}
+			}
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("reading %s: %v", ls.path, err)
+		}
+
+		var record logRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return fmt.Errorf("%w: %s at offset %d: %v", errCorruptStore, ls.path, offset, err)
+		}
+		if record.Version == 0 {
+			record.Version = logBaseSchemaVersion
+		}
+		if record.Version > playersSchemaVersion {
+			return fmt.Errorf("%s has a record with schema version %d at offset %d but this server only knows up to %d",
+				ls.path, record.Version, offset, playersSchemaVersion)
+		}
+		ls.apply(record, logEntry{offset: offset, length: int64(len(line)), version: record.Version})
+		offset += int64(len(line))
+	}
+
+	ls.size = offset
+	_, err := ls.file.Seek(ls.size, io.SeekStart)
+	return err
+}
+
+// validatePlayersLog checks that every complete record of a log is readable
+func validatePlayersLog(data []byte) error {
+	lines := bytes.Split(data, []byte("\n"))
+	// The last element is empty or a torn record, which load() drops
+	for i, line := range lines[:len(lines)-1] {
+		var record logRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return fmt.Errorf("record %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+// apply updates the index for a record stored at entry
+func (ls *logStore) apply(record logRecord, entry logEntry) {
+	if old, exists := ls.index[record.Key]; exists {
+		ls.live -= old.length
+		delete(ls.index, record.Key)
+	}
+	if record.Op == "put" && record.Player != nil {
+		ls.index[record.Key] = entry
+		ls.live += entry.length
+	}
+}
+
+// migrate upgrades the players of records written with an older schema
+// through playerMigrations, appending the results, then compacts the log so
+// only current records remain. The log as it was is kept in the backups directory.
+func (ls *logStore) migrate() error {
+	// Records of the same version are migrated together, as one players document
+	outdated := make(map[int]map[string]json.RawMessage)
+	for key, entry := range ls.index {
+		if entry.version == playersSchemaVersion {
+			continue
+		}
+		data := make([]byte, entry.length)
+		if _, err := ls.file.ReadAt(data, entry.offset); err != nil {
+			return err
+		}
+		var record struct {
+			Player json.RawMessage `json:"player"`
+		}
+		if err := json.Unmarshal(data, &record); err != nil {
+			return fmt.Errorf("%w: %s at offset %d: %v", errCorruptStore, ls.path, entry.offset, err)
+		}
+		if outdated[entry.version] == nil {
+			outdated[entry.version] = make(map[string]json.RawMessage)
+		}
+		outdated[entry.version][key] = record.Player
+	}
+	if len(outdated) == 0 {
+		return nil
+	}
+
+	versions := make([]int, 0, len(outdated))
+	for version := range outdated {
+		versions = append(versions, version)
+	}
+	sort.Ints(versions)
+
+	data, err := os.ReadFile(ls.path)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(backupsDir, 0755); err != nil {
+		return err
+	}
+	original := filepath.Join(backupsDir, fmt.Sprintf("%s.v%d.pre-migration", filepath.Base(ls.path), versions[0]))
+	if err := writeFileAtomic(original, data, 0644); err != nil {
+		return fmt.Errorf("backing up %s before migrating: %v", ls.path, err)
+	}
+
+	for _, version := range versions {
+		players := outdated[version]
+		doc, err := json.Marshal(map[string]interface{}{"version": version, "players": players})
+		if err != nil {
+			return err
+		}
+		migrated, _, err := migrateData(filepath.Base(ls.path), doc, playerMigrations)
+		if err != nil {
+			return err
+		}
+		var storage PlayerStorage
+		if err := json.Unmarshal(migrated, &storage); err != nil {
+			return fmt.Errorf("migrating %s: %v", ls.path, err)
+		}
+
+		keys := make([]string, 0, len(players))
+		for key := range players {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			record := logRecord{Op: "del", Key: key}
+			if player := storage.Players[key]; player != nil {
+				record = logRecord{Op: "put", Key: key, Player: player}
+			}
+			if err := ls.append(record); err != nil {
+				return fmt.Errorf("migrating %s: %v", ls.path, err)
+			}
+		}
+	}
+
+	log.Printf("Migrated %s (original kept as %s)", ls.path, original)
+	return ls.compact()
+}
+
+// importJSON copies every player of a JSON players file into the empty log
+func (ls *logStore) importJSON(path string) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+
+	source, err := openJSONStore(path)
+	if err != nil {
+		return fmt.Errorf("importing %s: %v", path, err)
+	}
+	for username, player := range source.players {
+		if err := ls.append(logRecord{Op: "put", Key: username, Player: player}); err != nil {
+			return fmt.Errorf("importing %s: %v", path, err)
+		}
+	}
+	log.Printf("Log store: imported %d players from %s", len(source.players), path)
+	return nil
+}
+
+// append writes one record to the end of the log, backing up the log first
+// every backupInterval; caller must hold mux
+func (ls *logStore) append(record logRecord) error {
+	if record.Op == "put" {
+		record.Version = playersSchemaVersion
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if time.Since(ls.lastBackup) >= backupInterval {
+		if err := backupFile(ls.path); err != nil {
+			log.Printf("Could not back up %s: %v", ls.path, err)
+		}
+		ls.lastBackup = time.Now()
+	}
+	if _, err := ls.file.WriteAt(data, ls.size); err != nil {
+		return err
+	}
+	if err := ls.file.Sync(); err != nil {
+		return err
+	}
+
+	ls.apply(record, logEntry{offset: ls.size, length: int64(len(data)), version: record.Version})
+	ls.size += int64(len(data))
+	return nil
+}
+
+// read decodes the record an index entry points at; caller must hold mux
+func (ls *logStore) read(entry logEntry) (*PlayerData, error) {
+	data := make([]byte, entry.length)
+	if _, err := ls.file.ReadAt(data, entry.offset); err != nil {
+		return nil, err
+	}
+
+	var record logRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("%s is corrupt at offset %d: %v", ls.path, entry.offset, err)
+	}
+	return record.Player, nil
+}
+
+// maybeCompact rewrites the log when stale records dominate it; caller must hold mux
+func (ls *logStore) maybeCompact() error {
+	if ls.size < compactMinSize || ls.size < ls.live*compactRatio {
+		return nil
+	}
+	return ls.compact()
+}
+
+// compact writes only the live records to a new log and swaps it in
+func (ls *logStore) compact() error {
+	if err := backupFile(ls.path); err != nil {
+		log.Printf("Could not back up %s: %v", ls.path, err)
+	}
+	ls.lastBackup = time.Now()
+
+	tmpPath := ls.path + ".compact"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(ls.index))
+	for key := range ls.index {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	index := make(map[string]logEntry, len(keys))
+	var offset int64
+	for _, key := range keys {
+		entry := ls.index[key]
+		data := make([]byte, entry.length)
+		if _, err := ls.file.ReadAt(data, entry.offset); err != nil {
+			tmp.Close()
+			os.Remove(tmpPath)
+			return err
+		}
+		if _, err := tmp.WriteAt(data, offset); err != nil {
+			tmp.Close()
+			os.Remove(tmpPath)
+			return err
+		}
+		index[key] = logEntry{offset: offset, length: entry.length, version: entry.version}
+		offset += entry.length
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, ls.path); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := syncDir(filepath.Dir(ls.path)); err != nil {
+		log.Printf("Log store: syncing directory of %s: %v", ls.path, err)
+	}
+
+	log.Printf("Log store: compacted %s from %d to %d bytes", ls.path, ls.size, offset)
+	ls.file.Close()
+	ls.file = tmp
+	ls.index = index
+	ls.size = offset
+	ls.live = offset
+	return nil
+}
+
+func (ls *logStore) Get(username string) (*PlayerData, error) {
+	ls.mux.Lock()
+	defer ls.mux.Unlock()
+
+	entry, exists := ls.index[username]
+	if !exists {
+		return nil, errPlayerNotFound
+	}
+	return ls.read(entry)
+}
+
+func (ls *logStore) Put(player *PlayerData) error {
+	ls.mux.Lock()
+	defer ls.mux.Unlock()
+
+	if err := ls.append(logRecord{Op: "put", Key: player.Username, Player: player}); err != nil {
+		return err
+	}
+	return ls.maybeCompact()
+}
+
+func (ls *logStore) List() ([]string, error) {
+	ls.mux.Lock()
+	defer ls.mux.Unlock()
+
+	names := make([]string, 0, len(ls.index))
+	for username := range ls.index {
+		names = append(names, username)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (ls *logStore) Delete(username string) error {
+	ls.mux.Lock()
+	defer ls.mux.Unlock()
+
+	if _, exists := ls.index[username]; !exists {
+		return nil
+	}
+	if err := ls.append(logRecord{Op: "del", Key: username}); err != nil {
+		return err
+	}
+	return ls.maybeCompact()
+}
+
+func (ls *logStore) Update(username string, fn func(player *PlayerData) error) error {
+	ls.mux.Lock()
+	defer ls.mux.Unlock()
+
+	entry, exists := ls.index[username]
+	if !exists {
+		return errPlayerNotFound
+	}
+	player, err := ls.read(entry)
+	if err != nil {
+		return err
+	}
+	if err := fn(player); err != nil {
+		return err
+	}
+
+	if err := ls.append(logRecord{Op: "put", Key: username, Player: player}); err != nil {
+		return err
+	}
+	return ls.maybeCompact()
+}
+
+func (ls *logStore) Close() error {
+	ls.mux.Lock()
+	defer ls.mux.Unlock()
+
+	return ls.file.Close()
+}
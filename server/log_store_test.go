@@ -0,0 +1,228 @@
+// log_store_test.go
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// logLine encodes one log record the way the store writes it
+func logLine(t *testing.T, record logRecord) string {
+	t.Helper()
+	data, err := json.Marshal(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data) + "\n"
+}
+
+func putRecord(username string, rating float64) logRecord {
+	return logRecord{Op: "put", Key: username, Version: playersSchemaVersion,
+		Player: &PlayerData{Username: username, Rating: rating}}
+}
+
+func TestLogStoreRecovery(t *testing.T) {
+	tests := []struct {
+		name      string
+		log       func(t *testing.T) string
+		wantErr   bool
+		corrupt   bool               // the error must be errCorruptStore, which -restore recovers from
+		wantUsers map[string]float64 // username -> rating
+	}{
+		{
+			name:      "empty log",
+			log:       func(t *testing.T) string { return "" },
+			wantUsers: map[string]float64{},
+		},
+		{
+			name: "clean log",
+			log: func(t *testing.T) string {
+				return logLine(t, putRecord("alice", 1200)) + logLine(t, putRecord("bob", 1300))
+			},
+			wantUsers: map[string]float64{"alice": 1200, "bob": 1300},
+		},
+		{
+			name: "later records win",
+			log: func(t *testing.T) string {
+				return logLine(t, putRecord("alice", 1200)) + logLine(t, putRecord("bob", 1300)) +
+					logLine(t, putRecord("alice", 1250)) + logLine(t, logRecord{Op: "del", Key: "bob"})
+			},
+			wantUsers: map[string]float64{"alice": 1250},
+		},
+		{
+			name: "torn final record",
+			log: func(t *testing.T) string {
+				torn := logLine(t, putRecord("bob", 1300))
+				return logLine(t, putRecord("alice", 1200)) + torn[:len(torn)/2]
+			},
+			wantUsers: map[string]float64{"alice": 1200},
+		},
+		{
+			name: "corrupt record before the end",
+			log: func(t *testing.T) string {
+				return logLine(t, putRecord("alice", 1200)) + "{\"op\":\"put\",\"key\":\n" +
+					logLine(t, putRecord("bob", 1300))
+			},
+			wantErr: true,
+			corrupt: true,
+		},
+		{
+			name: "record from a newer server",
+			log: func(t *testing.T) string {
+				record := putRecord("alice", 1200)
+				record.Version = playersSchemaVersion + 1
+				return logLine(t, record)
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			if err := os.WriteFile("players.db", []byte(tt.log(t)), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			store, err := openLogStore("players.db", "")
+			if tt.wantErr {
+				if err == nil {
+					store.Close()
+					t.Fatal("openLogStore() succeeded, want an error")
+				}
+				if errors.Is(err, errCorruptStore) != tt.corrupt {
+					t.Errorf("openLogStore() error = %v, corrupt = %v, want corrupt = %v",
+						err, errors.Is(err, errCorruptStore), tt.corrupt)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("openLogStore() error = %v", err)
+			}
+			defer store.Close()
+
+			got := make(map[string]float64)
+			names, _ := store.List()
+			for _, username := range names {
+				player, err := store.Get(username)
+				if err != nil {
+					t.Fatalf("Get(%q) error = %v", username, err)
+				}
+				got[username] = player.Rating
+			}
+			if !reflect.DeepEqual(got, tt.wantUsers) {
+				t.Errorf("players = %v, want %v", got, tt.wantUsers)
+			}
+
+			// The store must still take writes after recovering
+			if err := store.Put(&PlayerData{Username: "carol", Rating: 1100}); err != nil {
+				t.Fatalf("Put() after open error = %v", err)
+			}
+			data, err := os.ReadFile("players.db")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := validatePlayersLog(data); err != nil {
+				t.Errorf("log is not valid after a write: %v", err)
+			}
+		})
+	}
+}
+
+func TestLogStoreCompactionRoundTrip(t *testing.T) {
+	t.Chdir(t.TempDir())
+	store, err := openLogStore("players.db", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rewrite every player several times so most of the log is stale
+	want := make(map[string]*PlayerData)
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 20; i++ {
+			player := &PlayerData{
+				Username: fmt.Sprintf("player%02d", i),
+				Rating:   float64(1000 + 10*round + i),
+				Level:    round + 1,
+				Deck:     []string{"Pawn", "Knight", "Queen"},
+			}
+			if err := store.Put(player); err != nil {
+				t.Fatal(err)
+			}
+			want[player.Username] = player
+		}
+	}
+	for _, username := range []string{"player03", "player17"} {
+		if err := store.Delete(username); err != nil {
+			t.Fatal(err)
+		}
+		delete(want, username)
+	}
+	err = store.Update("player05", func(player *PlayerData) error {
+		player.Rating = 1999
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want["player05"].Rating = 1999
+
+	before := store.size
+	store.mux.Lock()
+	err = store.compact()
+	store.mux.Unlock()
+	if err != nil {
+		t.Fatalf("compact() error = %v", err)
+	}
+	if store.size >= before || store.size != store.live {
+		t.Errorf("after compaction size = %d (was %d), live = %d", store.size, before, store.live)
+	}
+	if len(listBackups("players.db")) == 0 {
+		t.Error("compaction didn't back up the log")
+	}
+	checkPlayers(t, store, want)
+
+	// Writes after the compaction land in the new file
+	want["player00"].Rating = 1500
+	if err := store.Put(want["player00"]); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := openLogStore("players.db", "")
+	if err != nil {
+		t.Fatalf("reopening the compacted log: %v", err)
+	}
+	defer reopened.Close()
+	checkPlayers(t, reopened, want)
+}
+
+// checkPlayers compares every stored player with want
+func checkPlayers(t *testing.T, store PlayerStore, want map[string]*PlayerData) {
+	t.Helper()
+	names, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != len(want) {
+		t.Errorf("List() has %d players, want %d", len(names), len(want))
+	}
+	for username, expected := range want {
+		player, err := store.Get(username)
+		if err != nil {
+			t.Errorf("Get(%q) error = %v", username, err)
+			continue
+		}
+		if player.Rating != expected.Rating || player.Level != expected.Level ||
+			!reflect.DeepEqual(player.Deck, expected.Deck) {
+			t.Errorf("Get(%q) = rating %g, level %d, deck %v; want rating %g, level %d, deck %v",
+				username, player.Rating, player.Level, player.Deck, expected.Rating, expected.Level, expected.Deck)
+		}
+	}
+}
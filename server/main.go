@@ -2,26 +2,51 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"log"
-	"math/rand"
 	"os"
-	"time"
+	"strings"
 )
 
 func main() {
-	rand.Seed(time.Now().UnixNano())
+	storeBackend := flag.String("store", StoreJSON,
+		fmt.Sprintf("player storage backend: %q (players.json) or %q (append-only players.db)", StoreJSON, StoreLog))
+	restore := flag.Bool("restore", false,
+		"if the player data file is corrupt, restore it from the latest good backup")
+	admins := flag.String("admins", "",
+		"comma-separated usernames allowed to run admin commands such as 'reload'")
+	chatFilter := flag.String("chat-filter", defaultChatFilterFile,
+		"file of words masked in chat, one per line (ignored if missing)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [port]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	store, err := openPlayerStore(*storeBackend, *restore)
+	if err != nil {
+		log.Fatal("Failed to open player store: ", err)
+	}
+	defer store.Close()
 
 	// Initialize default data files
-	initializeDefaultData()
+	initializeDefaultData(store)
 
-	server := NewServer()
+	server := NewServer(store, strings.Split(*admins, ","))
+	if err := server.reloadTemplates(); err != nil {
+		log.Fatal("Failed to load game templates: ", err)
+	}
+	if err := server.loadChatFilter(*chatFilter); err != nil {
+		log.Fatal("Failed to load chat filter: ", err)
+	}
 
 	port := "8080"
-	if len(os.Args) > 1 {
-		port = os.Args[1]
+	if flag.NArg() > 0 {
+		port = flag.Arg(0)
 	}
 
-	log.Printf("Starting TCR Server on port %s...", port)
+	log.Printf("Starting TCR Server on port %s (%s store)...", port, *storeBackend)
 	if err := server.Start(port); err != nil {
 		log.Fatal("Failed to start server:", err)
 	}
@@ -0,0 +1,438 @@
+// match.go
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Match is one independent game session between two players.
+// Every match owns its own state, event loop and broadcast scope.
+type Match struct {
+	ID       string
+	mode     string
+	seed     int64
+	rng      *rand.Rand // every random roll in the match comes from here
+	server   *Server
+	state    *GameState
+	stateMux sync.RWMutex
+	players  [2]*Client
+	decks    [2][]*Troop  // troops each player brought, in slot order
+	away     [2]time.Time // reconnect deadline of a disconnected player's held slot
+	dropped  [2]bool      // disconnected before the match started
+
+	actions  chan func()   // player actions, run one at a time by the event loop
+	done     chan struct{} // closed when the match ends
+	doneOnce sync.Once
+	recorder *replayRecorder // nil when the match is not recorded
+	playback bool            // re-simulating a replay; nothing is saved
+
+	damageDealt     [2]map[string]float64 // troop name -> damage dealt, per player
+	towersDestroyed [2]int
+
+	ranked       bool // result changes the players' ratings
+	practice     bool // against a bot; the human plays a copy and nothing is saved
+	ratingChange [2]float64
+
+	templates *GameTemplates // balance data as loaded when the match started
+	damage    *DamageModel
+	troopEXP  map[*Troop]float64 // unit EXP earned this match, for the summary
+	towerEXP  map[*Tower]float64
+	burns     []*burn // damage-over-time effects still running
+
+	turnLeft     int    // seconds left on the turn clock
+	turnTimeouts [2]int // consecutive turn clock timeouts per player
+	drawOffer    int    // player number with an open draw offer, or 0
+
+	spectators    map[*Client]bool // read-only observers; lock after stateMux
+	spectatorsMux sync.Mutex
+}
+
+// reconnectGracePeriod is how long a disconnected player's slot is held
+const reconnectGracePeriod = 60 * time.Second
+
+// newMatch creates a match for two clients in a game mode; player1 moves first.
+// The same seed and the same inputs always play out the same way.
+func newMatch(server *Server, id, mode string, seed int64, player1, player2 *Client) *Match {
+	return &Match{
+		ID:      id,
+		mode:    mode,
+		seed:    seed,
+		rng:     newRand(seed),
+		server:  server,
+		players: [2]*Client{player1, player2},
+		actions: make(chan func()),
+		done:    make(chan struct{}),
+		damageDealt: [2]map[string]float64{
+			make(map[string]float64),
+			make(map[string]float64),
+		},
+		troopEXP:   make(map[*Troop]float64),
+		towerEXP:   make(map[*Tower]float64),
+		spectators: make(map[*Client]bool),
+	}
+}
+
+// start initializes the game state and launches the match event loop
+func (m *Match) start() {
+	p1 := m.players[0]
+	p2 := m.players[1]
+
+	// Balance changes apply to the next match without a restart
+	m.templates = m.server.currentTemplates()
+	damage, err := newDamageModel(m.templates.Damage)
+	if err != nil {
+		log.Printf("Match #%s: %v, using default damage model", m.ID, err)
+		damage = defaultDamageModel()
+	}
+	m.damage = damage
+
+	m.stateMux.Lock()
+	m.state = &GameState{
+		Player1:       m.loadPlayer(p1),
+		Player2:       m.loadPlayer(p2),
+		Player1Mana:   5,
+		Player2Mana:   5,
+		GameStartTime: time.Now(),
+		GameDuration:  180,
+		IsGameActive:  true,
+		Turn:          1,
+		Mode:          m.mode,
+		Seed:          m.seed,
+	}
+	// Templates are authoritative: stored unit stats only carry levels
+	applyTemplates(m.state.Player1, m.templates)
+	applyTemplates(m.state.Player2, m.templates)
+	m.recorder = newReplayRecorder(m)
+	m.prepareDecks()
+	m.resetTurnClock()
+	dropped := m.dropped
+	m.stateMux.Unlock()
+
+	m.resetUnitsHP()
+
+	announcement := fmt.Sprintf("🎮 GAME STARTED! (match #%s) 🎮\n", m.ID)
+	announcement += fmt.Sprintf("Players: %s vs %s\n", p1.Username, p2.Username)
+	firstPlayer := ""
+	if m.mode == ModeRealTime {
+		announcement += "⚡ REAL-TIME mode: attack whenever you have enough mana!\n"
+	} else {
+		firstPlayer = p1.Username
+		announcement += fmt.Sprintf("%s goes first!\n", p1.Username)
+		if m.hasTurnClock() {
+			announcement += fmt.Sprintf("⏱️ Each turn has a %d-second clock; an idle turn passes.\n", m.templates.Rules.TurnSeconds)
+		}
+	}
+	announcement += "3 minutes battle begins now!\n"
+	announcement += "Type 'status' to see current game state.\n"
+	announcement += fmt.Sprintf("🎲 Match seed: %d\n", m.seed)
+	m.broadcastEvent(MsgGameStart, GameStartMessage{
+		MatchID:      m.ID,
+		Player1:      p1.Username,
+		Player2:      p2.Username,
+		FirstPlayer:  firstPlayer,
+		GameDuration: m.state.GameDuration,
+		Mode:         m.mode,
+		Seed:         m.seed,
+	}, announcement)
+
+	go m.run()
+
+	// Players who dropped while the match was being set up get the usual
+	// grace period, and forfeit if they don't come back
+	for i, client := range []*Client{p1, p2} {
+		if dropped[i] {
+			m.playerDisconnected(client, i+1)
+		}
+	}
+}
+
+// loadPlayer returns the data a client plays the match with. Bots bring their
+// own; in practice the human plays a copy so nothing earned carries over.
+func (m *Match) loadPlayer(c *Client) *PlayerData {
+	if c.bot != nil {
+		return c.bot.player
+	}
+	player := m.server.loadPlayerData(c.Username)
+	if m.practice && player != nil {
+		copied, err := copyPlayer(player)
+		if err != nil {
+			log.Printf("Match #%s: copying %s for practice: %v", m.ID, c.Username, err)
+		} else {
+			player = copied
+		}
+	}
+	return player
+}
+
+// prepareDecks validates the chosen decks; an invalid deck falls back to a
+// random one drawn from the match RNG. Caller must hold stateMux.
+func (m *Match) prepareDecks() {
+	for i, player := range []*PlayerData{m.state.Player1, m.state.Player2} {
+		if err := validateDeck(player, player.Deck); err != nil {
+			player.Deck = randomDeck(player, m.rng)
+			m.players[i].Send(fmt.Sprintf("⚠️ Your deck is invalid (%v). Using %s for this match.\n",
+				err, strings.Join(player.Deck, ", ")))
+		}
+		m.decks[i] = deckTroops(player)
+	}
+}
+
+// run is the match event loop. Player actions, mana regeneration and the game
+// clock are handled here one at a time until the match ends.
+func (m *Match) run() {
+	manaTicker := time.NewTicker(time.Second)
+	defer manaTicker.Stop()
+
+	gameTimer := time.NewTimer(time.Duration(m.state.GameDuration) * time.Second)
+	defer gameTimer.Stop()
+
+	for {
+		select {
+		case action := <-m.actions:
+			action()
+
+		case <-manaTicker.C:
+			m.regenerateMana()
+
+		case <-gameTimer.C:
+			m.stateMux.Lock()
+			if m.state.IsGameActive {
+				m.record(ReplayTimeout, 0, "")
+				m.handleGameTimeout()
+			}
+			m.stateMux.Unlock()
+
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// submit runs an action on the match event loop and waits for it to finish.
+// It returns false if the match has already ended.
+func (m *Match) submit(action func()) bool {
+	finished := make(chan struct{})
+	select {
+	case m.actions <- func() {
+		defer close(finished)
+		action()
+	}:
+		<-finished
+		return true
+	case <-m.done:
+		return false
+	}
+}
+
+// finish stops the event loop, removes the match from the running set and
+// saves its replay
+func (m *Match) finish() {
+	m.doneOnce.Do(func() {
+		close(m.done)
+		if m.playback {
+			return
+		}
+		m.server.unregisterMatch(m.ID)
+		m.saveReplay()
+	})
+}
+
+// resetUnitsHP resets all towers and troops to full HP
+func (m *Match) resetUnitsHP() {
+	m.stateMux.Lock()
+	defer m.stateMux.Unlock()
+
+	if m.state == nil {
+		return
+	}
+
+	for _, tower := range orderedTowers(m.state.Player1) {
+		tower.HP = tower.MaxHP
+		tower.Shield = 0
+	}
+
+	for _, tower := range orderedTowers(m.state.Player2) {
+		tower.HP = tower.MaxHP
+		tower.Shield = 0
+	}
+
+	for _, deck := range m.decks {
+		for _, troop := range deck {
+			troop.HP = troop.MaxHP
+		}
+	}
+}
+
+// deck returns the troops a player brought into this match
+func (m *Match) deck(playerNum int) []*Troop {
+	return m.decks[playerNum-1]
+}
+
+// isActive reports whether the match is still being played
+func (m *Match) isActive() bool {
+	m.stateMux.RLock()
+	defer m.stateMux.RUnlock()
+
+	return m.state != nil && m.state.IsGameActive
+}
+
+// isOver reports whether the match has finished. A match that is registered
+// but not started yet is not over.
+func (m *Match) isOver() bool {
+	select {
+	case <-m.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// playerDisconnected holds a disconnected player's slot for the grace period
+func (m *Match) playerDisconnected(client *Client, playerNum int) {
+	m.stateMux.Lock()
+	defer m.stateMux.Unlock()
+
+	idx := playerNum - 1
+	if m.players[idx] != client {
+		return
+	}
+	if m.state == nil {
+		// Not started yet: start() holds the slot once the state exists
+		m.dropped[idx] = true
+		return
+	}
+	if !m.state.IsGameActive {
+		return
+	}
+
+	deadline := time.Now().Add(reconnectGracePeriod)
+	m.players[idx] = nil
+	m.away[idx] = deadline
+
+	seconds := int(reconnectGracePeriod.Seconds())
+	m.broadcastEvent(MsgOpponentAway, ReconnectMessage{Username: client.Username, SecondsLeft: seconds},
+		fmt.Sprintf("⚠️ %s disconnected! Holding their slot for %d seconds...\n", client.Username, seconds))
+	log.Printf("Match #%s: %s disconnected, holding slot until %s",
+		m.ID, client.Username, deadline.Format(time.TimeOnly))
+
+	go m.reconnectCountdown(playerNum, client.Username, deadline)
+}
+
+// reconnectCountdown warns the opponent and forfeits the match if the player does not return
+func (m *Match) reconnectCountdown(playerNum int, username string, deadline time.Time) {
+	idx := playerNum - 1
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		m.stateMux.Lock()
+		if m.state == nil || !m.state.IsGameActive || !m.away[idx].Equal(deadline) {
+			// Match ended or the player came back
+			m.stateMux.Unlock()
+			return
+		}
+
+		remaining := int(time.Until(deadline).Round(time.Second).Seconds())
+		if remaining <= 0 {
+			m.away[idx] = time.Time{}
+			m.record(ReplayForfeit, playerNum, "")
+			m.forfeitDisconnected(playerNum)
+			m.stateMux.Unlock()
+			return
+		}
+
+		if remaining%10 == 0 || remaining <= 5 {
+			m.broadcastEvent(MsgOpponentAway, ReconnectMessage{Username: username, SecondsLeft: remaining},
+				fmt.Sprintf("⏳ %s has %d seconds to reconnect...\n", username, remaining))
+		}
+		m.stateMux.Unlock()
+	}
+}
+
+// forfeitDisconnected ends the match in favour of the opponent of a player who
+// did not reconnect in time. Caller must hold stateMux.
+func (m *Match) forfeitDisconnected(playerNum int) {
+	loser, winner := m.state.Player1.Username, m.state.Player2.Username
+	if playerNum == 2 {
+		loser, winner = winner, loser
+	}
+	m.endGame(3-playerNum, EndDisconnect, fmt.Sprintf("🔌 %s did not reconnect in time. %s wins by forfeit!",
+		loser, winner))
+}
+
+// heldSlot returns the player number held for a disconnected username, or 0
+func (m *Match) heldSlot(username string) int {
+	m.stateMux.RLock()
+	defer m.stateMux.RUnlock()
+
+	if m.state == nil || !m.state.IsGameActive {
+		return 0
+	}
+	if !m.away[0].IsZero() && m.state.Player1.Username == username {
+		return 1
+	}
+	if !m.away[1].IsZero() && m.state.Player2.Username == username {
+		return 2
+	}
+	return 0
+}
+
+// reconnect reattaches a returning player to their held slot and resyncs them
+func (m *Match) reconnect(client *Client, playerNum int) bool {
+	idx := playerNum - 1
+
+	m.stateMux.Lock()
+	if m.state == nil || !m.state.IsGameActive || m.away[idx].IsZero() {
+		m.stateMux.Unlock()
+		return false
+	}
+
+	m.away[idx] = time.Time{}
+	m.players[idx] = client
+	client.setMatch(m, playerNum)
+
+	m.broadcastEventToOthers(client, MsgOpponentBack, ReconnectMessage{Username: client.Username},
+		fmt.Sprintf("✅ %s reconnected! The match continues.\n", client.Username))
+	m.broadcastToSpectators(MsgOpponentBack, ReconnectMessage{Username: client.Username},
+		fmt.Sprintf("✅ %s reconnected! The match continues.\n", client.Username))
+	m.stateMux.Unlock()
+
+	log.Printf("Match #%s: %s reconnected as player %d", m.ID, client.Username, playerNum)
+	client.Send(fmt.Sprintf("🔄 Reconnected to match #%s. Here is the current state:\n", m.ID))
+	m.displayGameState(client, playerNum)
+	return true
+}
+
+// broadcastToAll sends message to both players and the spectators of this match
+func (m *Match) broadcastToAll(message string) {
+	for _, client := range m.players {
+		if client != nil {
+			client.Send(message)
+		}
+	}
+	m.broadcastToSpectators(MsgInfo, strings.TrimSpace(message), message)
+}
+
+// broadcastEvent sends a structured event to both players and the spectators of this match
+func (m *Match) broadcastEvent(msgType string, content interface{}, text string) {
+	for _, client := range m.players {
+		if client != nil {
+			client.SendEvent(msgType, content, text)
+		}
+	}
+	m.broadcastToSpectators(msgType, content, text)
+}
+
+// broadcastEventToOthers sends a structured event to every player except sender
+func (m *Match) broadcastEventToOthers(sender *Client, msgType string, content interface{}, text string) {
+	for _, client := range m.players {
+		if client != nil && client != sender {
+			client.SendEvent(msgType, content, text)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+// match_actions.go
+package main
+
+import "fmt"
+
+// handleMatchAction runs "pass", "surrender", "offer draw" or "accept" for a
+// player on the match event loop
+func (s *Server) handleMatchAction(client *Client, action string) {
+	if client.Spectating() != nil {
+		client.SendError("👀 Spectators can't issue game commands. Type 'spectate stop' to leave.\n")
+		return
+	}
+	match, playerNum := client.Match()
+	if match == nil || !match.isActive() {
+		client.SendError("❌ You are not in a match.\n")
+		return
+	}
+
+	var run func()
+	switch action {
+	case "pass":
+		run = func() { match.processPass(client, playerNum) }
+	case "surrender":
+		run = func() { match.processSurrender(client, playerNum) }
+	case "offer draw":
+		run = func() { match.processDrawOffer(client, playerNum) }
+	case "accept":
+		run = func() { match.processAcceptDraw(client, playerNum) }
+	default:
+		return
+	}
+	if !match.submit(run) {
+		client.SendError("❌ Game is not active.\n")
+	}
+}
+
+// processPass ends the player's turn without attacking; unspent mana carries over
+func (m *Match) processPass(c *Client, playerNum int) {
+	m.stateMux.Lock()
+	defer m.stateMux.Unlock()
+
+	if m.state == nil || !m.state.IsGameActive {
+		c.SendError("❌ Game not active.\n")
+		return
+	}
+	m.record(ReplayCommand, playerNum, "pass")
+
+	if m.mode == ModeRealTime {
+		c.SendError("❌ There are no turns to pass in real-time mode.\n")
+		return
+	}
+	if !m.hasTurn(playerNum) {
+		c.SendError("❌ Not your turn!\n")
+		return
+	}
+
+	m.takeAction(playerNum)
+
+	player, mana := m.state.Player1, m.state.Player1Mana
+	if playerNum == 2 {
+		player, mana = m.state.Player2, m.state.Player2Mana
+	}
+	m.broadcastToAll(fmt.Sprintf("⏭️ %s passes, banking %.0f mana.\n", player.Username, mana))
+	m.switchTurn()
+}
+
+// processSurrender resigns the match; the opponent wins
+func (m *Match) processSurrender(c *Client, playerNum int) {
+	m.stateMux.Lock()
+	defer m.stateMux.Unlock()
+
+	if m.state == nil || !m.state.IsGameActive {
+		c.SendError("❌ Game not active.\n")
+		return
+	}
+	m.record(ReplayCommand, playerNum, "surrender")
+
+	loser, winner := m.state.Player1.Username, m.state.Player2.Username
+	if playerNum == 2 {
+		loser, winner = winner, loser
+	}
+	m.endGame(3-playerNum, EndSurrender, fmt.Sprintf("🏳️ %s surrendered. %s wins!", loser, winner))
+}
+
+// processDrawOffer proposes a draw; offering back to an open offer agrees to it
+func (m *Match) processDrawOffer(c *Client, playerNum int) {
+	m.stateMux.Lock()
+	defer m.stateMux.Unlock()
+
+	if m.state == nil || !m.state.IsGameActive {
+		c.SendError("❌ Game not active.\n")
+		return
+	}
+	m.record(ReplayCommand, playerNum, "offer draw")
+
+	switch m.drawOffer {
+	case playerNum:
+		c.SendError("❌ You already offered a draw. Waiting for your opponent.\n")
+		return
+	case 3 - playerNum:
+		m.agreeDraw()
+		return
+	}
+
+	offerer, opponent := m.state.Player1.Username, m.state.Player2.Username
+	if playerNum == 2 {
+		offerer, opponent = opponent, offerer
+	}
+	if m.practice {
+		c.Send(fmt.Sprintf("🤖 %s declines the draw. Bots play to the end.\n", opponent))
+		return
+	}
+
+	m.drawOffer = playerNum
+	event := DrawOfferMessage{Username: offerer}
+	c.SendEvent(MsgDrawOffer, event, fmt.Sprintf("🤝 You offered %s a draw.\n", opponent))
+	m.broadcastEventToOthers(c, MsgDrawOffer, event,
+		fmt.Sprintf("🤝 %s offers a draw. Type 'accept' to agree, or keep playing to decline.\n", offerer))
+	m.broadcastToSpectators(MsgDrawOffer, event, fmt.Sprintf("🤝 %s offers %s a draw.\n", offerer, opponent))
+}
+
+// processAcceptDraw accepts the opponent's open draw offer
+func (m *Match) processAcceptDraw(c *Client, playerNum int) {
+	m.stateMux.Lock()
+	defer m.stateMux.Unlock()
+
+	if m.state == nil || !m.state.IsGameActive {
+		c.SendError("❌ Game not active.\n")
+		return
+	}
+	m.record(ReplayCommand, playerNum, "accept")
+
+	if m.drawOffer != 3-playerNum {
+		c.SendError("❌ Your opponent hasn't offered a draw. Use 'offer draw' to propose one.\n")
+		return
+	}
+	m.agreeDraw()
+}
+
+// agreeDraw ends the match in a draw both players agreed to. Caller must hold stateMux.
+func (m *Match) agreeDraw() {
+	m.drawOffer = 0
+	m.endGameDraw(EndDrawAgreed, fmt.Sprintf("🤝 %s and %s agreed to a draw.",
+		m.state.Player1.Username, m.state.Player2.Username))
+}
+
+// takeAction marks that the player made a move: it ends their run of turn
+// timeouts and declines any draw offer they didn't accept. Caller must hold stateMux.
+func (m *Match) takeAction(playerNum int) {
+	m.turnTimeouts[playerNum-1] = 0
+	m.playOnPastDrawOffer(playerNum)
+}
+
+// playOnPastDrawOffer declines the opponent's open draw offer when the player
+// makes a move instead of accepting. Caller must hold stateMux.
+func (m *Match) playOnPastDrawOffer(playerNum int) {
+	if m.drawOffer != 3-playerNum {
+		return
+	}
+	m.drawOffer = 0
+
+	player := m.state.Player1.Username
+	if playerNum == 2 {
+		player = m.state.Player2.Username
+	}
+	m.broadcastEvent(MsgDrawOffer, DrawOfferMessage{Username: player, Declined: true},
+		fmt.Sprintf("🙅 %s played on; the draw offer is declined.\n", player))
+}
@@ -0,0 +1,230 @@
+// match_actions_test.go
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// surrender has a player resign, as the event loop runs it
+func surrender(m *Match, playerNum int) {
+	m.processSurrender(m.players[playerNum-1], playerNum)
+}
+
+// offerDraw has a player offer a draw
+func offerDraw(m *Match, playerNum int) {
+	m.processDrawOffer(m.players[playerNum-1], playerNum)
+}
+
+// acceptDraw has a player accept the open draw offer
+func acceptDraw(m *Match, playerNum int) {
+	m.processAcceptDraw(m.players[playerNum-1], playerNum)
+}
+
+func TestMatchActions(t *testing.T) {
+	tests := []struct {
+		name       string
+		practice   bool
+		script     func(m *Match)
+		wantTurn   int
+		wantOffer  int    // player with an open draw offer
+		wantWinner string // empty while the match goes on, or for a draw
+		wantReason string
+		wantSaid   string // something the first player was told
+	}{
+		{
+			name:     "pass hands the turn over",
+			script:   func(m *Match) { pass(m, 1) },
+			wantTurn: 2,
+		},
+		{
+			name:     "pass out of turn",
+			script:   func(m *Match) { pass(m, 2) },
+			wantTurn: 1,
+		},
+		{
+			name:       "player 1 surrenders",
+			script:     func(m *Match) { surrender(m, 1) },
+			wantTurn:   1,
+			wantWinner: "bob",
+			wantReason: EndSurrender,
+		},
+		{
+			name:       "player 2 surrenders out of turn",
+			script:     func(m *Match) { surrender(m, 2) },
+			wantTurn:   1,
+			wantWinner: "alice",
+			wantReason: EndSurrender,
+		},
+		{
+			name:      "offer waits for an answer",
+			script:    func(m *Match) { offerDraw(m, 1) },
+			wantTurn:  1,
+			wantOffer: 1,
+		},
+		{
+			name: "offer and accept",
+			script: func(m *Match) {
+				offerDraw(m, 1)
+				acceptDraw(m, 2)
+			},
+			wantTurn:   1,
+			wantReason: EndDrawAgreed,
+		},
+		{
+			name: "crossing offers agree",
+			script: func(m *Match) {
+				offerDraw(m, 2)
+				offerDraw(m, 1)
+			},
+			wantTurn:   1,
+			wantReason: EndDrawAgreed,
+		},
+		{
+			name: "own offer can't be accepted",
+			script: func(m *Match) {
+				offerDraw(m, 1)
+				acceptDraw(m, 1)
+			},
+			wantTurn:  1,
+			wantOffer: 1,
+			wantSaid:  "hasn't offered a draw",
+		},
+		{
+			name:     "accept without an offer",
+			script:   func(m *Match) { acceptDraw(m, 1) },
+			wantTurn: 1,
+			wantSaid: "hasn't offered a draw",
+		},
+		{
+			name: "playing on declines the offer",
+			script: func(m *Match) {
+				pass(m, 1)
+				offerDraw(m, 1)
+				pass(m, 2)
+				acceptDraw(m, 2)
+			},
+			wantTurn: 1,
+			wantSaid: "bob played on; the draw offer is declined",
+		},
+		{
+			name:     "bots decline draws",
+			practice: true,
+			script:   func(m *Match) { offerDraw(m, 1) },
+			wantTurn: 1,
+			wantSaid: "Bots play to the end",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestMatch(t)
+			m.practice = tt.practice
+			conn := m.players[0].conn.(*recordConn)
+
+			tt.script(m)
+			if m.state.Turn != tt.wantTurn {
+				t.Errorf("turn = %d, want %d", m.state.Turn, tt.wantTurn)
+			}
+			if m.drawOffer != tt.wantOffer {
+				t.Errorf("open draw offer from player %d, want %d", m.drawOffer, tt.wantOffer)
+			}
+			if !strings.Contains(conn.output(), tt.wantSaid) {
+				t.Errorf("alice wasn't told %q, they saw:\n%s", tt.wantSaid, conn.output())
+			}
+			if !tt.practice {
+				checkEnding(t, m, tt.wantWinner, tt.wantReason)
+			}
+		})
+	}
+}
+
+// TestPracticeEndsWithoutRewards ends matches every way a player can and checks
+// that only ranked matches pay out EXP and rating
+func TestPracticeEndsWithoutRewards(t *testing.T) {
+	endings := []struct {
+		name   string
+		rules  RulesConfig
+		end    func(m *Match)
+		winner string // empty for a draw
+	}{
+		{"surrender", RulesConfig{}, func(m *Match) { surrender(m, 1) }, "bob"},
+		{
+			"turn clock forfeit",
+			RulesConfig{TurnSeconds: 5, MaxTurnTimeouts: 1},
+			func(m *Match) { tick(m, 5) },
+			"bob",
+		},
+		{
+			"time runs out",
+			RulesConfig{},
+			func(m *Match) {
+				m.stateMux.Lock()
+				m.handleGameTimeout()
+				m.stateMux.Unlock()
+			},
+			"",
+		},
+	}
+
+	for _, ending := range endings {
+		for _, practice := range []bool{false, true} {
+			name := ending.name + " ranked"
+			if practice {
+				name = ending.name + " practice"
+			}
+			t.Run(name, func(t *testing.T) {
+				m := newTestMatch(t)
+				m.practice, m.ranked = practice, !practice
+				m.templates.Rules = ending.rules
+				m.resetTurnClock()
+
+				ending.end(m)
+				if m.state.IsGameActive {
+					t.Fatal("the match didn't end")
+				}
+
+				for _, username := range []string{"alice", "bob"} {
+					stored, err := m.server.store.Get(username)
+					if err != nil {
+						t.Fatal(err)
+					}
+					rating := m.server.ratings.rating(username)
+
+					if practice {
+						if stored.EXP != 0 || stored.Level != 1 || stored.Rating != defaultRating || rating != defaultRating {
+							t.Errorf("%s earned EXP %g, level %d, rating %g (indexed %g) in practice",
+								username, stored.EXP, stored.Level, stored.Rating, rating)
+						}
+						continue
+					}
+
+					wantEXP := 10.0 // a draw
+					if ending.winner == username {
+						wantEXP = 30
+					} else if ending.winner != "" {
+						wantEXP = 0
+					}
+					if stored.EXP != wantEXP {
+						t.Errorf("%s has %g EXP, want %g", username, stored.EXP, wantEXP)
+					}
+					won, lost := ending.winner == username, ending.winner != "" && ending.winner != username
+					if (won && rating <= defaultRating) || (lost && rating >= defaultRating) {
+						t.Errorf("%s's rating is %g after the match", username, rating)
+					}
+				}
+
+				record := lastRecord(t, m.server, "alice")
+				if practice {
+					if record != nil {
+						t.Error("a practice match was written to the history")
+					}
+					return
+				}
+				if record == nil || !record.Ranked || record.Winner != ending.winner {
+					t.Errorf("history record = %+v, want a ranked result won by %q", record, ending.winner)
+				}
+			})
+		}
+	}
+}
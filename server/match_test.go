@@ -0,0 +1,47 @@
+// match_test.go
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDisconnectBeforeStartHoldsSlot(t *testing.T) {
+	tests := []struct {
+		name      string
+		playerNum int
+	}{
+		{"first player drops", 1},
+		{"second player drops", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, "alice", "bob")
+			alice, aliceConn := newTestClient(s, "alice")
+			bob, bobConn := newTestClient(s, "bob")
+			match := s.registerMatch(alice, bob, ModeTurnBased)
+			defer match.finish()
+
+			leaver, stayerConn := alice, bobConn
+			if tt.playerNum == 2 {
+				leaver, stayerConn = bob, aliceConn
+			}
+			s.removeClient(leaver)
+			match.start()
+
+			match.stateMux.RLock()
+			held := match.players[tt.playerNum-1] == nil && !match.away[tt.playerNum-1].IsZero()
+			match.stateMux.RUnlock()
+			if !held {
+				t.Fatal("the slot of the player who dropped before the start is not held")
+			}
+			if got := match.heldSlot(leaver.Username); got != tt.playerNum {
+				t.Errorf("heldSlot(%s) = %d, want %d", leaver.Username, got, tt.playerNum)
+			}
+			if !strings.Contains(stayerConn.output(), leaver.Username+" disconnected") {
+				t.Errorf("the opponent wasn't told, they saw:\n%s", stayerConn.output())
+			}
+		})
+	}
+}
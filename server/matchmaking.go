@@ -0,0 +1,248 @@
+// matchmaking.go
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	matchmakingInterval  = time.Second
+	baseRatingWindow     = 100              // rating difference accepted right after joining
+	ratingWindowStep     = 50               // added to the window every ratingWindowGrowth
+	ratingWindowGrowth   = 10 * time.Second // waiting this long widens the window by one step
+	queueUpdateInterval  = 15 * time.Second // how often waiting players get a progress update
+	defaultEstimatedWait = 15 * time.Second
+)
+
+// queueEntry is one player waiting for a match
+type queueEntry struct {
+	client     *Client
+	rating     int
+	mode       string // only players queued for the same mode are paired
+	joinedAt   time.Time
+	lastUpdate time.Time
+}
+
+// window returns the rating difference this entry accepts after waiting until now
+func (e *queueEntry) window(now time.Time) int {
+	return baseRatingWindow + ratingWindowStep*int(now.Sub(e.joinedAt)/ratingWindowGrowth)
+}
+
+// matchPair is two players matched for a game mode
+type matchPair struct {
+	players [2]*Client
+	mode    string
+}
+
+// Matchmaker pairs queued players by rating, widening the search over time
+type Matchmaker struct {
+	server  *Server
+	queue   []*queueEntry
+	paired  map[*Client]bool // taken from the queue, match not registered yet
+	avgWait time.Duration
+	mux     sync.Mutex
+}
+
+// NewMatchmaker creates an empty matchmaking queue
+func NewMatchmaker(server *Server) *Matchmaker {
+	return &Matchmaker{
+		server:  server,
+		paired:  make(map[*Client]bool),
+		avgWait: defaultEstimatedWait,
+	}
+}
+
+// enqueue adds a client to the queue for a game mode and reports their position
+func (mm *Matchmaker) enqueue(client *Client, rating int, mode string) {
+	mm.mux.Lock()
+	for _, entry := range mm.queue {
+		if entry.client == client {
+			mm.mux.Unlock()
+			client.Send("🔎 You are already in the matchmaking queue.\n")
+			return
+		}
+	}
+
+	now := time.Now()
+	entry := &queueEntry{
+		client:     client,
+		rating:     rating,
+		mode:       mode,
+		joinedAt:   now,
+		lastUpdate: now,
+	}
+	mm.queue = append(mm.queue, entry)
+
+	client.SendEvent(MsgQueue, QueueMessage{
+		Position:      len(mm.queue),
+		EstimatedWait: mm.avgWait.Seconds(),
+		RatingWindow:  entry.window(now),
+		Mode:          mode,
+	}, fmt.Sprintf("🔎 Searching for a %s opponent... Position %d in queue, estimated wait ~%.0fs\n"+
+		"Type 'leave' to cancel, or 'practice' to play a bot instead.\n",
+		modeName(mode), len(mm.queue), mm.avgWait.Seconds()))
+	mm.mux.Unlock()
+}
+
+// remove takes a client out of the queue; it reports whether the client was queued
+func (mm *Matchmaker) remove(client *Client) bool {
+	mm.mux.Lock()
+	defer mm.mux.Unlock()
+
+	for i, entry := range mm.queue {
+		if entry.client == client {
+			mm.queue = append(mm.queue[:i], mm.queue[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// isPaired reports whether the client was just paired and their match is being set up
+func (mm *Matchmaker) isPaired(client *Client) bool {
+	mm.mux.Lock()
+	defer mm.mux.Unlock()
+
+	return mm.paired[client]
+}
+
+// unpair forgets paired clients once their match is registered or abandoned
+func (mm *Matchmaker) unpair(clients ...*Client) {
+	mm.mux.Lock()
+	defer mm.mux.Unlock()
+
+	for _, client := range clients {
+		delete(mm.paired, client)
+	}
+}
+
+// sendStatus shows a client their queue position, search window and estimated wait
+func (mm *Matchmaker) sendStatus(client *Client) {
+	mm.mux.Lock()
+	defer mm.mux.Unlock()
+
+	now := time.Now()
+	for i, entry := range mm.queue {
+		if entry.client == client {
+			mm.sendQueueStatus(entry, i+1, now)
+			return
+		}
+	}
+	client.SendError("❌ You are not in the matchmaking queue. Type 'play' to join.\n")
+}
+
+// sendQueueStatus sends an entry its queue progress
+func (mm *Matchmaker) sendQueueStatus(entry *queueEntry, position int, now time.Time) {
+	waited := now.Sub(entry.joinedAt)
+	remaining := mm.avgWait - waited
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	entry.client.SendEvent(MsgQueue, QueueMessage{
+		Position:      position,
+		WaitedSeconds: waited.Seconds(),
+		EstimatedWait: remaining.Seconds(),
+		RatingWindow:  entry.window(now),
+		Mode:          entry.mode,
+	}, fmt.Sprintf("🔎 Queue position %d (%s) | waited %.0fs | estimated wait ~%.0fs | rating range ±%d\n",
+		position, modeName(entry.mode), waited.Seconds(), remaining.Seconds(), entry.window(now)))
+}
+
+// run periodically pairs compatible players until the server stops
+func (mm *Matchmaker) run() {
+	ticker := time.NewTicker(matchmakingInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for _, pair := range mm.findPairs() {
+			// A player may have disconnected since being paired
+			p1, p2 := pair.players[0], pair.players[1]
+			if !mm.server.isOnline(p1) || !mm.server.isOnline(p2) {
+				mm.unpair(p1, p2)
+				for _, client := range pair.players {
+					if mm.server.isOnline(client) {
+						mm.server.joinQueue(client, pair.mode)
+					}
+				}
+				continue
+			}
+
+			p1.Send(fmt.Sprintf("✅ Opponent found: %s\n", p2.Username))
+			p2.Send(fmt.Sprintf("✅ Opponent found: %s\n", p1.Username))
+			go mm.server.startMatch(p1, p2, pair.mode)
+		}
+	}
+}
+
+// findPairs removes and returns every pair that can be matched right now.
+// The longest-waiting player is served first and gets the closest rating
+// inside their current search window and the same game mode.
+func (mm *Matchmaker) findPairs() []matchPair {
+	mm.mux.Lock()
+	defer mm.mux.Unlock()
+
+	now := time.Now()
+	var pairs []matchPair
+
+	for i := 0; i < len(mm.queue); i++ {
+		entry := mm.queue[i]
+		window := entry.window(now)
+
+		best := -1
+		bestDiff := 0
+		for j := i + 1; j < len(mm.queue); j++ {
+			if mm.queue[j].mode != entry.mode {
+				continue
+			}
+			diff := abs(entry.rating - mm.queue[j].rating)
+			if diff <= window && (best == -1 || diff < bestDiff) {
+				best = j
+				bestDiff = diff
+			}
+		}
+
+		if best == -1 {
+			continue
+		}
+
+		opponent := mm.queue[best]
+		mm.recordWait(now.Sub(entry.joinedAt))
+		mm.recordWait(now.Sub(opponent.joinedAt))
+		log.Printf("Matchmaking: paired %s (%d) with %s (%d), %s mode",
+			entry.client.Username, entry.rating, opponent.client.Username, opponent.rating, entry.mode)
+
+		pairs = append(pairs, matchPair{players: [2]*Client{entry.client, opponent.client}, mode: entry.mode})
+		mm.paired[entry.client] = true
+		mm.paired[opponent.client] = true
+		mm.queue = append(mm.queue[:best], mm.queue[best+1:]...)
+		mm.queue = append(mm.queue[:i], mm.queue[i+1:]...)
+		i--
+	}
+
+	// Keep the remaining players informed
+	for i, entry := range mm.queue {
+		if now.Sub(entry.lastUpdate) >= queueUpdateInterval {
+			entry.lastUpdate = now
+			mm.sendQueueStatus(entry, i+1, now)
+		}
+	}
+
+	return pairs
+}
+
+// recordWait folds an observed wait time into the running estimate
+func (mm *Matchmaker) recordWait(wait time.Duration) {
+	mm.avgWait = (mm.avgWait*3 + wait) / 4
+}
+
+// abs returns the absolute value of an int
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,274 @@
+// migrate.go
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// migration upgrades a decoded data file by one schema version
+type migration struct {
+	description string
+	apply       func(doc map[string]interface{}) error
+}
+
+// playerMigrations[i] upgrades players.json from version i to i+1.
+// Append new steps at the end; never edit a released one.
+var playerMigrations = []migration{
+	{"drop empty accounts and fill in missing usernames", migratePlayersDropEmpty},
+	{"reset unit EXP that held template rewards", migratePlayersResetUnitEXP},
+	{"add decks and ratings", migratePlayersDeckAndRating},
+	{"drop accounts without a username", migratePlayersDropNameless},
+}
+
+// templateMigrations[i] upgrades game_templates.json from version i to i+1
+var templateMigrations = []migration{
+	{"add crit chances and the damage section", migrateTemplatesCritAndDamage},
+	{"turn special texts into abilities", migrateTemplatesAbilities},
+	{"add the rules section with the turn clock off", migrateTemplatesRules},
+}
+
+// Current schema versions, written into every saved file
+var (
+	playersSchemaVersion   = len(playerMigrations)
+	templatesSchemaVersion = len(templateMigrations)
+)
+
+// migrateData upgrades one data file's contents to the newest schema. It
+// returns the original bytes when the file is already current. Unreadable
+// JSON is reported as errCorruptStore.
+func migrateData(name string, data []byte, registry []migration) ([]byte, bool, error) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, false, fmt.Errorf("%w: parsing %s: %v", errCorruptStore, name, err)
+	}
+
+	version := 0
+	if v, ok := doc["version"].(float64); ok {
+		version = int(v)
+	}
+	if version > len(registry) {
+		return nil, false, fmt.Errorf("%s has schema version %d but this server only knows up to %d",
+			name, version, len(registry))
+	}
+	if version == len(registry) {
+		return data, false, nil
+	}
+
+	for v := version; v < len(registry); v++ {
+		log.Printf("Migrating %s: v%d -> v%d: %s", name, v, v+1, registry[v].description)
+		if err := registry[v].apply(doc); err != nil {
+			return nil, false, fmt.Errorf("migrating %s to v%d: %v", name, v+1, err)
+		}
+	}
+	doc["version"] = len(registry)
+
+	migrated, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, false, err
+	}
+	return migrated, true, nil
+}
+
+// migrateFile upgrades a data file in place, keeping the original in the
+// backups directory. It returns the file's (possibly migrated) contents.
+func migrateFile(path string, registry []migration) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	migrated, changed, err := migrateData(filepath.Base(path), data, registry)
+	if err != nil || !changed {
+		return migrated, err
+	}
+
+	if err := os.MkdirAll(backupsDir, 0755); err != nil {
+		return nil, err
+	}
+	original := filepath.Join(backupsDir, fmt.Sprintf("%s.v%d.pre-migration", filepath.Base(path), schemaVersion(data)))
+	if err := writeFileAtomic(original, data, 0644); err != nil {
+		return nil, fmt.Errorf("backing up %s before migrating: %v", path, err)
+	}
+	if err := writeFileAtomic(path, migrated, 0644); err != nil {
+		return nil, err
+	}
+	log.Printf("Migrated %s (original kept as %s)", path, original)
+	return migrated, nil
+}
+
+// schemaVersion reads the version field of a data file, 0 if it has none
+func schemaVersion(data []byte) int {
+	var header struct {
+		Version int `json:"version"`
+	}
+	json.Unmarshal(data, &header)
+	return header.Version
+}
+
+// eachPlayer calls fn for every non-null account of a players document
+func eachPlayer(doc map[string]interface{}, fn func(username string, player map[string]interface{})) {
+	players, _ := doc["players"].(map[string]interface{})
+	for username, value := range players {
+		if player, ok := value.(map[string]interface{}); ok {
+			fn(username, player)
+		}
+	}
+}
+
+// migratePlayersDropEmpty removes null accounts, which crash logins, and
+// makes sure every account knows its own username
+func migratePlayersDropEmpty(doc map[string]interface{}) error {
+	players, _ := doc["players"].(map[string]interface{})
+	if players == nil {
+		doc["players"] = map[string]interface{}{}
+		return nil
+	}
+
+	for username, value := range players {
+		if value == nil {
+			log.Printf("  dropping empty account '%s'", username)
+			delete(players, username)
+		}
+	}
+	eachPlayer(doc, func(username string, player map[string]interface{}) {
+		if name, _ := player["username"].(string); name == "" {
+			player["username"] = username
+		}
+	})
+	return nil
+}
+
+// migratePlayersResetUnitEXP clears unit EXP. Before units had their own
+// progression, accounts were created with each template's EXP reward copied
+// into the unit, which would now count as earned EXP.
+func migratePlayersResetUnitEXP(doc map[string]interface{}) error {
+	eachPlayer(doc, func(username string, player map[string]interface{}) {
+		troops, _ := player["troops"].([]interface{})
+		for _, value := range troops {
+			if troop, ok := value.(map[string]interface{}); ok {
+				troop["exp"] = 0
+			}
+		}
+		towers, _ := player["towers"].(map[string]interface{})
+		for _, value := range towers {
+			if tower, ok := value.(map[string]interface{}); ok {
+				tower["exp"] = 0
+			}
+		}
+	})
+	return nil
+}
+
+// migratePlayersDeckAndRating gives every account a deck and a starting rating
+func migratePlayersDeckAndRating(doc map[string]interface{}) error {
+	eachPlayer(doc, func(username string, player map[string]interface{}) {
+		if rating, _ := player["rating"].(float64); rating <= 0 {
+			player["rating"] = defaultRating
+		}
+
+		if deck, _ := player["deck"].([]interface{}); len(deck) > 0 {
+			return
+		}
+		// Older accounts owned exactly the troops they fought with
+		deck := []interface{}{}
+		troops, _ := player["troops"].([]interface{})
+		for _, value := range troops {
+			troop, _ := value.(map[string]interface{})
+			if name, _ := troop["name"].(string); name != "" && len(deck) < deckSize {
+				deck = append(deck, name)
+			}
+		}
+		player["deck"] = deck
+	})
+	return nil
+}
+
+// migratePlayersDropNameless removes accounts stored under an empty key or
+// with an empty username. Registration never allowed them, so they can't log
+// in, yet they were ranked on the leaderboard. The pre-migration copy in the
+// backups directory still holds them.
+func migratePlayersDropNameless(doc map[string]interface{}) error {
+	players, _ := doc["players"].(map[string]interface{})
+	for key, value := range players {
+		player, _ := value.(map[string]interface{})
+		name, _ := player["username"].(string)
+		if strings.TrimSpace(key) == "" || strings.TrimSpace(name) == "" {
+			log.Printf("  dropping account '%s' with no username", key)
+			delete(players, key)
+		}
+	}
+	return nil
+}
+
+// migrateTemplatesCritAndDamage adds the crit chance and damage settings
+// introduced with the configurable damage model
+func migrateTemplatesCritAndDamage(doc map[string]interface{}) error {
+	troops, _ := doc["troops"].([]interface{})
+	for _, value := range troops {
+		troop, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if _, exists := troop["crit"]; !exists {
+			crit := 0.0
+			if atk, _ := troop["atk"].(float64); atk > 0 {
+				crit = 0.05
+			}
+			troop["crit"] = crit
+		}
+	}
+
+	if _, exists := doc["damage"]; !exists {
+		doc["damage"] = map[string]interface{}{
+			"formula":         defaultDamageFormula,
+			"min_damage":      0,
+			"crit_multiplier": defaultCritMultiplier,
+		}
+	}
+	return nil
+}
+
+// migrateTemplatesRules adds the rules section. The turn clock starts off so
+// existing setups and saved replays play exactly as before.
+func migrateTemplatesRules(doc map[string]interface{}) error {
+	if _, exists := doc["rules"]; !exists {
+		doc["rules"] = map[string]interface{}{
+			"turn_seconds":      0,
+			"max_turn_timeouts": 0,
+		}
+	}
+	return nil
+}
+
+// legacySpecials maps the special texts the engine used to hardcode to the
+// abilities that replace them
+var legacySpecials = map[string][]interface{}{
+	"Heal 300 to lowest HP tower": {map[string]interface{}{"effect": EffectHealLowest, "amount": 300}},
+}
+
+// migrateTemplatesAbilities gives troops with a hardcoded special its ability.
+// The text stays as the troop's description.
+func migrateTemplatesAbilities(doc map[string]interface{}) error {
+	troops, _ := doc["troops"].([]interface{})
+	for _, value := range troops {
+		troop, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if _, exists := troop["abilities"]; exists {
+			continue
+		}
+		special, _ := troop["special"].(string)
+		if abilities, known := legacySpecials[special]; known {
+			troop["abilities"] = abilities
+		} else if special != "" {
+			log.Printf("  troop %v: special %q has no matching ability, keeping it as a description only", troop["name"], special)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,293 @@
+// migrate_test.go
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// readTestdata returns a fixture from the testdata directory
+func readTestdata(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// TestMigratePlayersFromV0 upgrades the players.json the server shipped with
+// before schema versions existed
+func TestMigratePlayersFromV0(t *testing.T) {
+	migrated, changed, err := migrateData("players.json", readTestdata(t, "players_v0.json"), playerMigrations)
+	if err != nil {
+		t.Fatalf("migrateData() error = %v", err)
+	}
+	if !changed {
+		t.Fatal("migrateData() reported a v0 file as current")
+	}
+
+	var storage PlayerStorage
+	if err := json.Unmarshal(migrated, &storage); err != nil {
+		t.Fatalf("migrated file doesn't decode: %v", err)
+	}
+	if storage.Version != playersSchemaVersion {
+		t.Errorf("version = %d, want %d", storage.Version, playersSchemaVersion)
+	}
+
+	// The null accounts and the one stored under an empty name are gone
+	var names []string
+	for username := range storage.Players {
+		names = append(names, username)
+	}
+	sort.Strings(names)
+	if want := []string{"12", "123", "help"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("players = %v, want %v", names, want)
+	}
+
+	tests := []struct {
+		username string
+		deck     []string
+	}{
+		{"12", []string{"Rook", "Bishop", "Prince"}},
+		{"123", []string{"Rook", "Bishop", "Queen"}},
+		{"help", []string{"Prince", "Knight", "Queen"}},
+	}
+	for _, tt := range tests {
+		player := storage.Players[tt.username]
+		if player.Username != tt.username {
+			t.Errorf("%s: username = %q", tt.username, player.Username)
+		}
+		if player.Rating != defaultRating {
+			t.Errorf("%s: rating = %g, want %g", tt.username, player.Rating, defaultRating)
+		}
+		if !reflect.DeepEqual(player.Deck, tt.deck) {
+			t.Errorf("%s: deck = %v, want %v", tt.username, player.Deck, tt.deck)
+		}
+		for _, troop := range player.Troops {
+			if troop.EXP != 0 {
+				t.Errorf("%s: %s kept %g template EXP", tt.username, troop.Name, troop.EXP)
+			}
+		}
+		for position, tower := range player.Towers {
+			if tower.EXP != 0 {
+				t.Errorf("%s: %s kept %g template EXP", tt.username, position, tower.EXP)
+			}
+		}
+	}
+
+	// Migrating again is a no-op
+	again, changed, err := migrateData("players.json", migrated, playerMigrations)
+	if err != nil || changed || string(again) != string(migrated) {
+		t.Errorf("migrating a current file: changed = %v, err = %v", changed, err)
+	}
+}
+
+func TestMigratePlayerSteps(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want map[string]PlayerData // expected username, rating and deck per key
+	}{
+		{
+			name: "no players section",
+			doc:  `{}`,
+			want: map[string]PlayerData{},
+		},
+		{
+			name: "missing username is filled from the key",
+			doc:  `{"players": {"alice": {"troops": [{"name": "Pawn", "exp": 5}]}}}`,
+			want: map[string]PlayerData{"alice": {Username: "alice", Rating: defaultRating, Deck: []string{"Pawn"}}},
+		},
+		{
+			name: "empty key is dropped at v3",
+			doc:  `{"version": 3, "players": {"": {"username": "", "rating": 1500}, "bob": {"username": "bob", "rating": 1300, "deck": ["Rook"]}}}`,
+			want: map[string]PlayerData{"bob": {Username: "bob", Rating: 1300, Deck: []string{"Rook"}}},
+		},
+		{
+			name: "blank username is dropped at v3",
+			doc:  `{"version": 3, "players": {"ghost": {"username": "  ", "rating": 1500}}}`,
+			want: map[string]PlayerData{},
+		},
+		{
+			name: "existing deck and rating are kept",
+			doc:  `{"version": 2, "players": {"carol": {"username": "carol", "rating": 1450, "deck": ["Queen"], "troops": [{"name": "Pawn"}]}}}`,
+			want: map[string]PlayerData{"carol": {Username: "carol", Rating: 1450, Deck: []string{"Queen"}}},
+		},
+		{
+			name: "decks are capped at the deck size",
+			doc:  `{"version": 2, "players": {"dave": {"username": "dave", "troops": [{"name": "Pawn"}, {"name": "Rook"}, {"name": "Knight"}, {"name": "Prince"}]}}}`,
+			want: map[string]PlayerData{"dave": {Username: "dave", Rating: defaultRating, Deck: []string{"Pawn", "Rook", "Knight"}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrated, _, err := migrateData("players.json", []byte(tt.doc), playerMigrations)
+			if err != nil {
+				t.Fatalf("migrateData() error = %v", err)
+			}
+			var storage PlayerStorage
+			if err := json.Unmarshal(migrated, &storage); err != nil {
+				t.Fatal(err)
+			}
+
+			got := make(map[string]PlayerData)
+			for key, player := range storage.Players {
+				got[key] = PlayerData{Username: player.Username, Rating: player.Rating, Deck: player.Deck}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("players = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestMigrateTemplatesFromV0 upgrades the game_templates.json the server
+// shipped with before schema versions existed
+func TestMigrateTemplatesFromV0(t *testing.T) {
+	migrated, changed, err := migrateData("game_templates.json", readTestdata(t, "game_templates_v0.json"), templateMigrations)
+	if err != nil {
+		t.Fatalf("migrateData() error = %v", err)
+	}
+	if !changed {
+		t.Fatal("migrateData() reported a v0 file as current")
+	}
+
+	var templates GameTemplates
+	if err := json.Unmarshal(migrated, &templates); err != nil {
+		t.Fatalf("migrated file doesn't decode: %v", err)
+	}
+	if templates.Version != templatesSchemaVersion {
+		t.Errorf("version = %d, want %d", templates.Version, templatesSchemaVersion)
+	}
+	if err := validateTemplates(&templates); err != nil {
+		t.Fatalf("migrated templates are invalid: %v", err)
+	}
+
+	want := DamageConfig{Formula: defaultDamageFormula, CritMultiplier: defaultCritMultiplier}
+	if templates.Damage != want {
+		t.Errorf("damage = %+v, want %+v", templates.Damage, want)
+	}
+	if templates.Rules != (RulesConfig{}) {
+		t.Errorf("rules = %+v, want the turn clock off", templates.Rules)
+	}
+
+	for _, troop := range templates.Troops {
+		wantCrit := 0.05
+		if troop.ATK <= 0 {
+			wantCrit = 0
+		}
+		if troop.CRIT != wantCrit {
+			t.Errorf("%s: crit = %g, want %g", troop.Name, troop.CRIT, wantCrit)
+		}
+	}
+
+	queen := templates.troop("Queen")
+	if queen == nil {
+		t.Fatal("Queen is missing")
+	}
+	wantAbilities := []Ability{{Effect: EffectHealLowest, Amount: 300}}
+	if !reflect.DeepEqual(queen.Abilities, wantAbilities) {
+		t.Errorf("Queen abilities = %+v, want %+v", queen.Abilities, wantAbilities)
+	}
+	if queen.Special != "Heal 300 to lowest HP tower" {
+		t.Errorf("Queen lost its description: %q", queen.Special)
+	}
+}
+
+func TestMigrateDataErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		corrupt bool
+	}{
+		{"not JSON", `{"players": `, true},
+		{"not an object", `[1, 2]`, true},
+		{"newer than the server", `{"version": 99, "players": {}}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := migrateData("players.json", []byte(tt.data), playerMigrations)
+			if err == nil {
+				t.Fatal("migrateData() succeeded, want an error")
+			}
+			if errors.Is(err, errCorruptStore) != tt.corrupt {
+				t.Errorf("migrateData() error = %v, want corrupt = %v", err, tt.corrupt)
+			}
+		})
+	}
+}
+
+func TestMigrateFileKeepsOriginal(t *testing.T) {
+	original := readTestdata(t, "game_templates_v0.json")
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile(templatesFile, original, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	migrated, err := migrateFile(templatesFile, templateMigrations)
+	if err != nil {
+		t.Fatalf("migrateFile() error = %v", err)
+	}
+	onDisk, _ := os.ReadFile(templatesFile)
+	if string(onDisk) != string(migrated) {
+		t.Error("migrateFile() didn't write the migrated contents")
+	}
+	kept, err := os.ReadFile(filepath.Join(backupsDir, templatesFile+".v0.pre-migration"))
+	if err != nil {
+		t.Fatalf("original not kept: %v", err)
+	}
+	if string(kept) != string(original) {
+		t.Error("the kept original differs from the file before migration")
+	}
+}
+
+// TestLogStoreMigratesOldRecords opens a players.db written before records
+// carried a schema version
+func TestLogStoreMigratesOldRecords(t *testing.T) {
+	t.Chdir(t.TempDir())
+	legacy := `{"op":"put","key":"alice","player":{"username":"alice","rating":1300,"deck":["Pawn"],"troops":[{"name":"Pawn","exp":40}]}}
+{"op":"put","key":"","player":{"username":"","rating":1500}}
+{"op":"put","key":"bob","version":1,"player":{"username":"bob","troops":[{"name":"Rook","exp":25}]}}
+`
+	if err := os.WriteFile("players.db", []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := openLogStore("players.db", "")
+	if err != nil {
+		t.Fatalf("openLogStore() error = %v", err)
+	}
+	defer store.Close()
+
+	names, _ := store.List()
+	if want := []string{"alice", "bob"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("players = %v, want %v", names, want)
+	}
+	// Unversioned records are current apart from the later steps, so alice
+	// keeps the EXP her Pawn earned; bob's v1 record still held template EXP
+	alice, _ := store.Get("alice")
+	if alice.Troops[0].EXP != 40 || alice.Rating != 1300 {
+		t.Errorf("alice = EXP %g, rating %g; want 40, 1300", alice.Troops[0].EXP, alice.Rating)
+	}
+	bob, _ := store.Get("bob")
+	if bob.Troops[0].EXP != 0 || bob.Rating != defaultRating || !reflect.DeepEqual(bob.Deck, []string{"Rook"}) {
+		t.Errorf("bob = EXP %g, rating %g, deck %v; want 0, %g, [Rook]", bob.Troops[0].EXP, bob.Rating, bob.Deck, defaultRating)
+	}
+
+	for key, entry := range store.index {
+		if entry.version != playersSchemaVersion {
+			t.Errorf("%s: record version %d after migrating, want %d", key, entry.version, playersSchemaVersion)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(backupsDir, "players.db.v1.pre-migration")); err != nil {
+		t.Errorf("original log not kept: %v", err)
+	}
+}
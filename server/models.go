@@ -14,6 +14,7 @@ type Tower struct {
 	EXP      float64 `json:"exp"`
 	Level    int     `json:"level"`
 	Position string  `json:"position"`
+	Shield   float64 `json:"shield,omitempty"` // absorbs damage before HP; lasts one match
 }
 
 // Troop represents an attacking unit
@@ -36,7 +37,10 @@ type PlayerData struct {
 	EXP      float64           `json:"exp"`
 	Level    int               `json:"level"`
 	Towers   map[string]*Tower `json:"towers"`
-	Troops   []*Troop          `json:"troops"`
+	Troops   []*Troop          `json:"troops"`          // card collection
+	Deck     []string          `json:"deck"`            // troop names brought into matches
+	Rating   float64           `json:"rating"`          // Elo skill rating from ranked matches
+	Muted    []string          `json:"muted,omitempty"` // players whose chat is hidden
 }
 
 // GameState manages the current game session
@@ -49,6 +53,27 @@ type GameState struct {
 	GameDuration  int         `json:"game_duration"` // seconds
 	IsGameActive  bool        `json:"is_game_active"`
 	Turn          int         `json:"turn"` // 1 for player1, 2 for player2
+	Mode          string      `json:"mode"` // ModeTurnBased or ModeRealTime
+	Seed          int64       `json:"seed"` // seeds the match RNG (crits, fallback decks)
+}
+
+// Game modes
+const (
+	ModeTurnBased = "turn"     // players alternate, one attack per turn
+	ModeRealTime  = "realtime" // both players attack whenever they have mana
+)
+
+// validMode reports whether mode names a known game mode
+func validMode(mode string) bool {
+	return mode == ModeTurnBased || mode == ModeRealTime
+}
+
+// modeName returns the display name of a game mode
+func modeName(mode string) string {
+	if mode == ModeRealTime {
+		return "real-time"
+	}
+	return "turn-based"
 }
 
 // Message types for network communication
@@ -63,10 +88,36 @@ type AttackMessage struct {
 }
 
 type GameStatusMessage struct {
+	MatchID        string            `json:"match_id"`
+	Opponent       string            `json:"opponent"`
+	IsGameActive   bool              `json:"is_game_active"`
+	Mode           string            `json:"mode"`
+	YourTurn       bool              `json:"your_turn"`
 	PlayerMana     float64           `json:"player_mana"`
 	OpponentMana   float64           `json:"opponent_mana"`
 	TimeRemaining  float64           `json:"time_remaining"`
 	PlayerTowers   map[string]*Tower `json:"player_towers"`
 	OpponentTowers map[string]*Tower `json:"opponent_towers"`
 	PlayerTroops   []*Troop          `json:"player_troops"`
+	Spectators     int               `json:"spectators"`
+	TurnTimeLeft   int               `json:"turn_time_left,omitempty"` // seconds on the turn clock, when timed
+}
+
+// SpectatorStatusMessage is a spectator's view of both sides of a match
+type SpectatorStatusMessage struct {
+	MatchID       string            `json:"match_id"`
+	Mode          string            `json:"mode"`
+	IsGameActive  bool              `json:"is_game_active"`
+	Turn          int               `json:"turn"`
+	Player1       string            `json:"player1"`
+	Player2       string            `json:"player2"`
+	Player1Mana   float64           `json:"player1_mana"`
+	Player2Mana   float64           `json:"player2_mana"`
+	TimeRemaining float64           `json:"time_remaining"`
+	TurnTimeLeft  int               `json:"turn_time_left,omitempty"`
+	Player1Towers map[string]*Tower `json:"player1_towers"`
+	Player2Towers map[string]*Tower `json:"player2_towers"`
+	Player1Troops []*Troop          `json:"player1_troops"`
+	Player2Troops []*Troop          `json:"player2_troops"`
+	Spectators    int               `json:"spectators"`
 }
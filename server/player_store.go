@@ -0,0 +1,225 @@
+// player_store.go
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// errPlayerNotFound is returned by a PlayerStore for an unknown username
+var errPlayerNotFound = errors.New("player not found")
+
+// PlayerStore persists player accounts. Implementations are safe for
+// concurrent use; every method is atomic with respect to the others.
+type PlayerStore interface {
+	// Get returns a copy of the stored player, or errPlayerNotFound
+	Get(username string) (*PlayerData, error)
+	// Put stores the player under its username, replacing any previous record
+	Put(player *PlayerData) error
+	// List returns every stored username, sorted
+	List() ([]string, error)
+	// Delete removes a player; deleting an unknown player is not an error
+	Delete(username string) error
+	// Update loads a player, lets fn change it and stores the result, all under
+	// the store's lock. Nothing is written if fn returns an error.
+	Update(username string, fn func(player *PlayerData) error) error
+	// Close flushes and releases the store
+	Close() error
+}
+
+// Storage backends selectable with -store
+const (
+	StoreJSON = "json" // the whole players.json rewritten on every change
+	StoreLog  = "log"  // append-only log with an in-memory index
+)
+
+// openPlayerStore opens the named backend. A corrupt data file stops the
+// server unless restore is set, in which case the newest good backup replaces it.
+func openPlayerStore(backend string, restore bool) (PlayerStore, error) {
+	var path string
+	var open func() (PlayerStore, error)
+	var validate func(data []byte) error
+
+	switch backend {
+	case StoreJSON:
+		path = "players.json"
+		open = func() (PlayerStore, error) { return openJSONStore(path) }
+		validate = validatePlayersJSON
+	case StoreLog:
+		path = "players.db"
+		open = func() (PlayerStore, error) { return openLogStore(path, "players.json") }
+		validate = validatePlayersLog
+	default:
+		return nil, fmt.Errorf("unknown store %q (use %q or %q)", backend, StoreJSON, StoreLog)
+	}
+
+	store, err := open()
+	if errors.Is(err, errCorruptStore) {
+		if !restore {
+			return nil, fmt.Errorf("%v\nRefusing to start so no accounts are overwritten. "+
+				"Run with -restore to recover from the latest good backup in %s/", err, backupsDir)
+		}
+		if err := restoreLatestBackup(path, validate); err != nil {
+			return nil, err
+		}
+		store, err = open()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep a copy of the file as it was at startup
+	if err := backupFile(path); err != nil {
+		log.Printf("Could not back up %s: %v", path, err)
+	}
+	return store, nil
+}
+
+// validatePlayersJSON checks that data is a readable players.json
+func validatePlayersJSON(data []byte) error {
+	var storage PlayerStorage
+	return json.Unmarshal(data, &storage)
+}
+
+// copyPlayer deep-copies a player record so callers never share the store's copy
+func copyPlayer(player *PlayerData) (*PlayerData, error) {
+	data, err := json.Marshal(player)
+	if err != nil {
+		return nil, err
+	}
+	var copied PlayerData
+	if err := json.Unmarshal(data, &copied); err != nil {
+		return nil, err
+	}
+	return &copied, nil
+}
+
+// jsonStore keeps every player in one JSON document (players.json)
+type jsonStore struct {
+	path       string
+	players    map[string]*PlayerData
+	lastBackup time.Time
+	mux        sync.Mutex
+}
+
+// openJSONStore loads the players file into memory
+func openJSONStore(path string) (*jsonStore, error) {
+	store := &jsonStore{path: path, players: make(map[string]*PlayerData), lastBackup: time.Now()}
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return store, nil
+	}
+	// Older files are upgraded to the current schema before they're decoded
+	data, err := migrateFile(path, playerMigrations)
+	if err != nil {
+		if errors.Is(err, errCorruptStore) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("reading %s: %v", path, err)
+	}
+
+	var storage PlayerStorage
+	if err := json.Unmarshal(data, &storage); err != nil {
+		return nil, fmt.Errorf("%w: parsing %s: %v", errCorruptStore, path, err)
+	}
+	for username, player := range storage.Players {
+		if player != nil {
+			store.players[username] = player
+		}
+	}
+	return store, nil
+}
+
+// save atomically rewrites the whole file, backing up the previous version
+// every backupInterval; caller must hold mux
+func (js *jsonStore) save() error {
+	data, err := json.MarshalIndent(PlayerStorage{Version: playersSchemaVersion, Players: js.players}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if time.Since(js.lastBackup) >= backupInterval {
+		if err := backupFile(js.path); err != nil {
+			log.Printf("Could not back up %s: %v", js.path, err)
+		}
+		js.lastBackup = time.Now()
+	}
+	return writeFileAtomic(js.path, data, 0644)
+}
+
+func (js *jsonStore) Get(username string) (*PlayerData, error) {
+	js.mux.Lock()
+	defer js.mux.Unlock()
+
+	player, exists := js.players[username]
+	if !exists {
+		return nil, errPlayerNotFound
+	}
+	return copyPlayer(player)
+}
+
+func (js *jsonStore) Put(player *PlayerData) error {
+	stored, err := copyPlayer(player)
+	if err != nil {
+		return err
+	}
+
+	js.mux.Lock()
+	defer js.mux.Unlock()
+
+	js.players[player.Username] = stored
+	return js.save()
+}
+
+func (js *jsonStore) List() ([]string, error) {
+	js.mux.Lock()
+	defer js.mux.Unlock()
+
+	names := make([]string, 0, len(js.players))
+	for username := range js.players {
+		names = append(names, username)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (js *jsonStore) Delete(username string) error {
+	js.mux.Lock()
+	defer js.mux.Unlock()
+
+	if _, exists := js.players[username]; !exists {
+		return nil
+	}
+	delete(js.players, username)
+	return js.save()
+}
+
+func (js *jsonStore) Update(username string, fn func(player *PlayerData) error) error {
+	js.mux.Lock()
+	defer js.mux.Unlock()
+
+	stored, exists := js.players[username]
+	if !exists {
+		return errPlayerNotFound
+	}
+	player, err := copyPlayer(stored)
+	if err != nil {
+		return err
+	}
+	if err := fn(player); err != nil {
+		return err
+	}
+
+	js.players[username] = player
+	return js.save()
+}
+
+func (js *jsonStore) Close() error {
+	return nil
+}
@@ -0,0 +1,134 @@
+// progression.go
+package main
+
+import "fmt"
+
+// Unit EXP rewards and curves
+const (
+	troopEXPPerDamage  = 0.1  // EXP per point of damage dealt to a tower
+	towerBountyDefault = 50.0 // EXP for destroying a tower without a template bounty
+	towerSurvivalEXP   = 40.0 // EXP for each tower still standing at the end of a match
+	troopEXPPerLevel   = 60.0 // troops need troopEXPPerLevel * level EXP for the next level
+	towerEXPPerLevel   = 80.0 // towers need towerEXPPerLevel * level EXP for the next level
+	unitLevelStatBoost = 1.1  // stat multiplier per unit level
+)
+
+// towerPositions lists tower slots in attack order
+var towerPositions = []string{"guard1", "guard2", "king"}
+
+// orderedTowers returns a player's towers in attack order. Match code walks
+// towers through this instead of the map, whose order varies run to run and
+// would make replays diverge.
+func orderedTowers(player *PlayerData) []*Tower {
+	towers := make([]*Tower, 0, len(towerPositions))
+	for _, pos := range towerPositions {
+		if tower := player.Towers[pos]; tower != nil {
+			towers = append(towers, tower)
+		}
+	}
+	return towers
+}
+
+// awardTroopEXP credits a troop for the damage it dealt and any tower it destroyed
+func (m *Match) awardTroopEXP(troop *Troop, damage float64, destroyed *Tower) {
+	gained := damage * troopEXPPerDamage
+
+	if destroyed != nil {
+		bounty := towerBountyDefault
+		if template := m.templates.tower(destroyed.Type); template != nil && template.EXP > 0 {
+			bounty = template.EXP
+		}
+		gained += bounty
+	}
+
+	troop.EXP += gained
+	m.troopEXP[troop] += gained
+}
+
+// awardTowerSurvival credits every tower that is still standing when the match ends
+func (m *Match) awardTowerSurvival(player *PlayerData) {
+	for _, tower := range orderedTowers(player) {
+		if tower.HP > 0 {
+			tower.EXP += towerSurvivalEXP
+			m.towerEXP[tower] += towerSurvivalEXP
+		}
+	}
+}
+
+// applyUnitProgression levels up both players' units and returns the summary
+// text and level-ups for the game over announcement
+func (m *Match) applyUnitProgression() (string, []UnitLevelUpMessage) {
+	var levelUps []UnitLevelUpMessage
+	summary := "📈 UNIT PROGRESSION:\n"
+
+	for _, player := range []*PlayerData{m.state.Player1, m.state.Player2} {
+		m.awardTowerSurvival(player)
+
+		for _, troop := range player.Troops {
+			oldLevel := troop.Level
+			if checkTroopLevelUp(troop) {
+				levelUps = append(levelUps, UnitLevelUpMessage{
+					Owner: player.Username, Unit: troop.Name, Level: troop.Level})
+			}
+			summary += unitProgressLine(player.Username, troop.Name, m.troopEXP[troop], oldLevel, troop.Level)
+		}
+
+		for _, pos := range towerPositions {
+			tower := player.Towers[pos]
+			if tower == nil {
+				continue
+			}
+			oldLevel := tower.Level
+			if checkTowerLevelUp(tower) {
+				levelUps = append(levelUps, UnitLevelUpMessage{
+					Owner: player.Username, Unit: pos, Level: tower.Level})
+			}
+			summary += unitProgressLine(player.Username, pos, m.towerEXP[tower], oldLevel, tower.Level)
+		}
+	}
+
+	return summary, levelUps
+}
+
+// unitProgressLine formats one unit's EXP gain for the summary, or nothing if it gained none
+func unitProgressLine(owner, unit string, gained float64, oldLevel, newLevel int) string {
+	if gained <= 0 && oldLevel == newLevel {
+		return ""
+	}
+
+	line := fmt.Sprintf("   %s's %s +%.0f EXP", owner, unit, gained)
+	if newLevel > oldLevel {
+		line += fmt.Sprintf(" 🎊 Lv %d → Lv %d!", oldLevel, newLevel)
+	}
+	return line + "\n"
+}
+
+// checkTroopLevelUp levels a troop on its own curve; it reports whether it leveled
+func checkTroopLevelUp(troop *Troop) bool {
+	leveled := false
+	for troop.EXP >= troopEXPPerLevel*float64(troop.Level) {
+		troop.EXP -= troopEXPPerLevel * float64(troop.Level)
+		troop.Level++
+		troop.HP *= unitLevelStatBoost
+		troop.MaxHP *= unitLevelStatBoost
+		troop.ATK *= unitLevelStatBoost
+		troop.DEF *= unitLevelStatBoost
+		leveled = true
+	}
+	return leveled
+}
+
+// checkTowerLevelUp levels a tower on its own curve; it reports whether it leveled
+func checkTowerLevelUp(tower *Tower) bool {
+	leveled := false
+	for tower.EXP >= towerEXPPerLevel*float64(tower.Level) {
+		tower.EXP -= towerEXPPerLevel * float64(tower.Level)
+		tower.Level++
+		tower.HP *= unitLevelStatBoost
+		tower.MaxHP *= unitLevelStatBoost
+		tower.ATK *= unitLevelStatBoost
+		tower.DEF *= unitLevelStatBoost
+		leveled = true
+	}
+	return leveled
+}
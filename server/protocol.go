@@ -0,0 +1,323 @@
+// protocol.go
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Protocol modes a client can negotiate
+const (
+	ProtocolText = "text" // human-readable box-drawing output (default)
+	ProtocolJSON = "json" // newline-delimited Message envelopes
+)
+
+// Message types sent by the server in JSON mode
+const (
+	MsgInfo          = "info"
+	MsgError         = "error"
+	MsgPrompt        = "prompt"
+	MsgProtocol      = "protocol"
+	MsgWelcome       = "welcome"
+	MsgHelp          = "help"
+	MsgQueue         = "queue"
+	MsgGameStart     = "game_start"
+	MsgStatus        = "status"
+	MsgAttackResult  = "attack_result"
+	MsgTurn          = "turn"
+	MsgTowerDown     = "tower_destroyed"
+	MsgCounterattack = "counterattack"
+	MsgGameOver      = "game_over"
+	MsgDeck          = "deck"
+	MsgOpponentAway  = "player_disconnected"
+	MsgOpponentBack  = "player_reconnected"
+	MsgReplay        = "replay"
+	MsgReplayList    = "replay_list"
+	MsgHistory       = "history"
+	MsgStats         = "stats"
+	MsgLeaderboard   = "leaderboard"
+	MsgAbility       = "ability"
+	MsgSpectate      = "spectate"
+	MsgLiveMatches   = "live_matches"
+	MsgChat          = "chat"
+	MsgTurnTimer     = "turn_timer"
+	MsgDrawOffer     = "draw_offer"
+)
+
+// WelcomeMessage is sent after a successful login
+type WelcomeMessage struct {
+	Username string  `json:"username"`
+	Level    int     `json:"level"`
+	EXP      float64 `json:"exp"`
+	Rating   float64 `json:"rating"`
+}
+
+// QueueMessage reports matchmaking progress
+type QueueMessage struct {
+	Position      int     `json:"position"`
+	WaitedSeconds float64 `json:"waited_seconds"`
+	EstimatedWait float64 `json:"estimated_wait_seconds"`
+	RatingWindow  int     `json:"rating_window"`
+	Mode          string  `json:"mode"`
+}
+
+// DeckMessage shows a player's deck and card collection
+type DeckMessage struct {
+	Deck       []string `json:"deck"`
+	Collection []*Troop `json:"collection"`
+}
+
+// GameStartMessage announces a new match
+type GameStartMessage struct {
+	MatchID      string `json:"match_id"`
+	Player1      string `json:"player1"`
+	Player2      string `json:"player2"`
+	FirstPlayer  string `json:"first_player,omitempty"`
+	GameDuration int    `json:"game_duration"`
+	Mode         string `json:"mode"`
+	Seed         int64  `json:"seed"`
+}
+
+// AttackResultMessage describes the outcome of one attack
+type AttackResultMessage struct {
+	Attacker    string  `json:"attacker"`
+	Defender    string  `json:"defender"`
+	Troop       string  `json:"troop"`
+	Target      string  `json:"target"`
+	Damage      float64 `json:"damage"`
+	Crit        bool    `json:"crit"`
+	TargetHP    float64 `json:"target_hp"`
+	TargetMaxHP float64 `json:"target_max_hp"`
+}
+
+// CounterattackMessage describes a tower striking back at a troop
+type CounterattackMessage struct {
+	Owner      string  `json:"owner"`
+	Tower      string  `json:"tower"`
+	Troop      string  `json:"troop"`
+	TroopOwner string  `json:"troop_owner"`
+	Damage     float64 `json:"damage"`
+	Crit       bool    `json:"crit"`
+	TroopHP    float64 `json:"troop_hp"`
+	TroopMaxHP float64 `json:"troop_max_hp"`
+	KnockedOut bool    `json:"knocked_out"`
+}
+
+// TurnMessage announces whose turn it is
+type TurnMessage struct {
+	Turn     int    `json:"turn"`
+	Username string `json:"username"`
+}
+
+// TurnTimerMessage warns about a running turn clock or reports that it ran out
+type TurnTimerMessage struct {
+	Username    string `json:"username"`
+	SecondsLeft int    `json:"seconds_left,omitempty"`
+	TimedOut    bool   `json:"timed_out"`
+	Timeouts    int    `json:"timeouts,omitempty"`     // consecutive timeouts of this player
+	MaxTimeouts int    `json:"max_timeouts,omitempty"` // timeouts that forfeit; 0 never forfeits
+}
+
+// DrawOfferMessage reports a draw offer, or that the other player played on
+type DrawOfferMessage struct {
+	Username string `json:"username"` // who offered, or who declined
+	Declined bool   `json:"declined"`
+}
+
+// TowerDestroyedMessage announces a destroyed tower
+type TowerDestroyedMessage struct {
+	Owner    string `json:"owner"`
+	Tower    string `json:"tower"`
+	Position string `json:"position"`
+}
+
+// AbilityMessage reports what a troop's ability did
+type AbilityMessage struct {
+	Owner  string  `json:"owner"`
+	Troop  string  `json:"troop"`
+	Effect string  `json:"effect"`
+	Target string  `json:"target,omitempty"` // tower position, if the effect hit one
+	Amount float64 `json:"amount"`
+}
+
+// ReconnectMessage reports a held slot's reconnect countdown
+type ReconnectMessage struct {
+	Username    string `json:"username"`
+	SecondsLeft int    `json:"seconds_left,omitempty"`
+}
+
+// SpectateMessage reports a spectator joining or leaving a match
+type SpectateMessage struct {
+	MatchID    string `json:"match_id"`
+	Username   string `json:"username"`
+	Joined     bool   `json:"joined"`
+	Spectators int    `json:"spectators"`
+}
+
+// LiveMatchEntry is one spectatable match in a LiveMatchesMessage
+type LiveMatchEntry struct {
+	MatchID    string  `json:"match_id"`
+	Player1    string  `json:"player1"`
+	Player2    string  `json:"player2"`
+	Mode       string  `json:"mode"`
+	Elapsed    float64 `json:"elapsed"` // seconds since the match started
+	Spectators int     `json:"spectators"`
+}
+
+// LiveMatchesMessage lists the matches that can be spectated, oldest first
+type LiveMatchesMessage struct {
+	Matches []LiveMatchEntry `json:"matches"`
+}
+
+// ReplayMessage announces the start or end of a replay
+type ReplayMessage struct {
+	MatchID  string  `json:"match_id"`
+	Player1  string  `json:"player1"`
+	Player2  string  `json:"player2"`
+	Mode     string  `json:"mode"`
+	Seed     int64   `json:"seed"`
+	Speed    float64 `json:"speed"`
+	Finished bool    `json:"finished"`
+}
+
+// ReplayListEntry is one saved replay in a ReplayListMessage
+type ReplayListEntry struct {
+	MatchID   string    `json:"match_id"`
+	Player1   string    `json:"player1"`
+	Player2   string    `json:"player2"`
+	Mode      string    `json:"mode"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// ReplayListMessage lists the most recent saved replays, newest first
+type ReplayListMessage struct {
+	Replays []ReplayListEntry `json:"replays"`
+}
+
+// HistoryMessage lists a player's recent matches, newest first
+type HistoryMessage struct {
+	Username string         `json:"username"`
+	Matches  []*MatchRecord `json:"matches"`
+}
+
+// UnitLevelUpMessage reports a troop or tower reaching a new level
+type UnitLevelUpMessage struct {
+	Owner string `json:"owner"`
+	Unit  string `json:"unit"`
+	Level int    `json:"level"`
+}
+
+// RatingChangeMessage reports a player's new rating after a ranked match
+type RatingChangeMessage struct {
+	Username string  `json:"username"`
+	Rating   float64 `json:"rating"`
+	Change   float64 `json:"change"`
+}
+
+// LeaderboardMessage lists the top players and the requester's own entry
+type LeaderboardMessage struct {
+	Top []LeaderboardEntry `json:"top"`
+	You *LeaderboardEntry  `json:"you,omitempty"`
+}
+
+// GameOverMessage announces the end of a match
+type GameOverMessage struct {
+	Winner        string                `json:"winner,omitempty"`
+	Loser         string                `json:"loser,omitempty"`
+	Draw          bool                  `json:"draw"`
+	Message       string                `json:"message"`
+	LevelUps      []UnitLevelUpMessage  `json:"level_ups,omitempty"`
+	RatingChanges []RatingChangeMessage `json:"rating_changes,omitempty"`
+}
+
+// Send writes a human-readable message; JSON clients receive it as an info envelope
+func (c *Client) Send(message string) {
+	c.SendEvent(MsgInfo, strings.TrimSpace(message), message)
+}
+
+// SendError writes an error message; JSON clients receive it as an error envelope
+func (c *Client) SendError(message string) {
+	c.SendEvent(MsgError, strings.TrimSpace(message), message)
+}
+
+// SendEvent writes a structured event in JSON mode or its text rendering otherwise
+func (c *Client) SendEvent(msgType string, content interface{}, text string) {
+	c.writeMux.Lock()
+	defer c.writeMux.Unlock()
+
+	if c.protocol != ProtocolJSON {
+		c.conn.Write([]byte(text))
+		return
+	}
+
+	data, err := json.Marshal(Message{Type: msgType, Content: content})
+	if err != nil {
+		fmt.Printf("Error marshaling %s message: %v\n", msgType, err)
+		return
+	}
+	c.conn.Write(append(data, '\n'))
+}
+
+// setProtocol switches the wire format for all later messages
+func (c *Client) setProtocol(protocol string) {
+	c.writeMux.Lock()
+	defer c.writeMux.Unlock()
+
+	c.protocol = protocol
+}
+
+// isJSON reports whether the client negotiated the JSON protocol
+func (c *Client) isJSON() bool {
+	c.writeMux.Lock()
+	defer c.writeMux.Unlock()
+
+	return c.protocol == ProtocolJSON
+}
+
+// decodeInput turns one line received from the client into a text command.
+// In JSON mode the line must be a Message envelope:
+//
+//	{"type":"attack","content":{"troop_index":1,"target":"guard1"}}
+//	{"type":"command","content":"status"}
+//	{"type":"input","content":"alice"}
+//	{"type":"status"}
+func (c *Client) decodeInput(line string) (string, error) {
+	if !c.isJSON() {
+		return strings.TrimSpace(line), nil
+	}
+
+	var raw struct {
+		Type    string          `json:"type"`
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal([]byte(line), &raw); err != nil {
+		return "", fmt.Errorf("invalid JSON message: %v", err)
+	}
+
+	switch raw.Type {
+	case "":
+		return "", fmt.Errorf("message type is required")
+
+	case "attack":
+		var attack AttackMessage
+		if err := json.Unmarshal(raw.Content, &attack); err != nil {
+			return "", fmt.Errorf("invalid attack content: %v", err)
+		}
+		return fmt.Sprintf("attack %d %s", attack.TroopIndex, attack.Target), nil
+	}
+
+	// Any other type may carry a string argument
+	var arg string
+	if len(raw.Content) > 0 && string(raw.Content) != "null" {
+		if err := json.Unmarshal(raw.Content, &arg); err != nil {
+			return "", fmt.Errorf("content of %q must be a string", raw.Type)
+		}
+	}
+
+	if raw.Type == "command" || raw.Type == "input" {
+		return strings.TrimSpace(arg), nil
+	}
+	return strings.TrimSpace(raw.Type + " " + arg), nil
+}
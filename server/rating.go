@@ -0,0 +1,191 @@
+// rating.go
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Elo rating settings
+const (
+	defaultRating = 1200.0
+	ratingK       = 32.0 // largest possible change from one match
+
+	defaultLeaderboardSize = 10
+	maxLeaderboardSize     = 50
+)
+
+// ratingOf returns a player's skill rating; accounts that never played ranked start at the default
+func ratingOf(player *PlayerData) float64 {
+	if player.Rating <= 0 {
+		return defaultRating
+	}
+	return player.Rating
+}
+
+// expectedScore is the chance of a player rated a beating a player rated b
+func expectedScore(a, b float64) float64 {
+	return 1 / (1 + math.Pow(10, (b-a)/400))
+}
+
+// eloChange returns the rating change for a player scoring score (1 win, 0.5 draw, 0 loss)
+func eloChange(rating, opponentRating, score float64) float64 {
+	return math.Round(ratingK * (score - expectedScore(rating, opponentRating)))
+}
+
+// applyRatings updates both players' ratings after a ranked match and returns
+// the summary for the game-over message. winnerNum is 0 for a draw.
+// Caller must hold stateMux.
+func (m *Match) applyRatings(winnerNum int) (string, []RatingChangeMessage) {
+	if !m.ranked || m.playback {
+		return "", nil
+	}
+
+	players := [2]*PlayerData{m.state.Player1, m.state.Player2}
+	scores := [2]float64{0.5, 0.5}
+	if winnerNum != 0 {
+		scores[winnerNum-1] = 1
+		scores[2-winnerNum] = 0
+	}
+
+	before := [2]float64{ratingOf(players[0]), ratingOf(players[1])}
+	summary := "📊 RATING:\n"
+	var changes []RatingChangeMessage
+	for i, player := range players {
+		change := eloChange(before[i], before[1-i], scores[i])
+		player.Rating = before[i] + change
+		m.ratingChange[i] = change
+		m.server.ratings.update(player)
+
+		summary += fmt.Sprintf("   %s: %.0f (%+.0f)\n", player.Username, player.Rating, change)
+		changes = append(changes, RatingChangeMessage{
+			Username: player.Username,
+			Rating:   player.Rating,
+			Change:   change,
+		})
+	}
+	return summary, changes
+}
+
+// LeaderboardEntry is one ranked player
+type LeaderboardEntry struct {
+	Rank     int     `json:"rank"`
+	Username string  `json:"username"`
+	Rating   float64 `json:"rating"`
+	Level    int     `json:"level"`
+}
+
+// ratingIndex keeps every account's rating and level in memory so the
+// leaderboard never has to read the whole store
+type ratingIndex struct {
+	entries map[string]LeaderboardEntry
+	mux     sync.RWMutex
+}
+
+// newRatingIndex builds the index with one pass over the store
+func newRatingIndex(store PlayerStore) *ratingIndex {
+	index := &ratingIndex{entries: make(map[string]LeaderboardEntry)}
+	names, err := store.List()
+	if err != nil {
+		fmt.Printf("Error listing players: %v\n", err)
+	}
+	for _, username := range names {
+		if player, err := store.Get(username); err == nil {
+			index.update(player)
+		}
+	}
+	return index
+}
+
+// update records a player's current rating and level. Callers pass a player
+// they are allowed to read, e.g. under the match's stateMux.
+func (r *ratingIndex) update(player *PlayerData) {
+	if player == nil || player.Username == "" {
+		return
+	}
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	r.entries[player.Username] = LeaderboardEntry{
+		Username: player.Username,
+		Rating:   ratingOf(player),
+		Level:    player.Level,
+	}
+}
+
+// rating returns an account's current rating, the default if it isn't indexed
+func (r *ratingIndex) rating(username string) float64 {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	if entry, exists := r.entries[username]; exists {
+		return entry.Rating
+	}
+	return defaultRating
+}
+
+// rankedPlayers returns every account ordered by rating, highest first
+func (s *Server) rankedPlayers() []LeaderboardEntry {
+	s.ratings.mux.RLock()
+	entries := make([]LeaderboardEntry, 0, len(s.ratings.entries))
+	for _, entry := range s.ratings.entries {
+		entries = append(entries, entry)
+	}
+	s.ratings.mux.RUnlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Rating != entries[j].Rating {
+			return entries[i].Rating > entries[j].Rating
+		}
+		return entries[i].Username < entries[j].Username
+	})
+	for i := range entries {
+		entries[i].Rank = i + 1
+	}
+	return entries
+}
+
+// showLeaderboard shows the top N players and the requester's own rank
+func (s *Server) showLeaderboard(client *Client, args []string) {
+	size := defaultLeaderboardSize
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 || n > maxLeaderboardSize {
+			client.SendError(fmt.Sprintf("❌ Usage: leaderboard [1-%d]\n", maxLeaderboardSize))
+			return
+		}
+		size = n
+	}
+
+	entries := s.rankedPlayers()
+	total := len(entries)
+	var own *LeaderboardEntry
+	for i := range entries {
+		if entries[i].Username == client.Username {
+			own = &entries[i]
+			break
+		}
+	}
+	if len(entries) > size {
+		entries = entries[:size]
+	}
+
+	output := fmt.Sprintf("\n🏆 LEADERBOARD - TOP %d\n", size)
+	for _, entry := range entries {
+		marker := "  "
+		if entry.Username == client.Username {
+			marker = "👉"
+		}
+		output += fmt.Sprintf("%s #%-3d %-16s %5.0f  (Lv %d)\n", marker, entry.Rank, entry.Username, entry.Rating, entry.Level)
+	}
+	message := LeaderboardMessage{Top: entries}
+	if own != nil {
+		output += fmt.Sprintf("📍 Your rank: #%d of %d with %.0f rating\n", own.Rank, total, own.Rating)
+		message.You = own
+	}
+
+	client.SendEvent(MsgLeaderboard, message, output)
+}
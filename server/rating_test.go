@@ -0,0 +1,57 @@
+// rating_test.go
+package main
+
+import "testing"
+
+func TestEloChange(t *testing.T) {
+	tests := []struct {
+		name             string
+		rating, opponent float64
+		score            float64
+		want             float64
+	}{
+		{"even win", 1200, 1200, 1, 16},
+		{"even draw", 1200, 1200, 0.5, 0},
+		{"even loss", 1200, 1200, 0, -16},
+		{"underdog win", 1200, 1600, 1, 29},
+		{"favourite win", 1600, 1200, 1, 3},
+		{"favourite loss", 1600, 1200, 0, -29},
+		{"favourite draw", 1600, 1200, 0.5, -13},
+		{"huge gap win", 1000, 3000, 1, 32},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := eloChange(tt.rating, tt.opponent, tt.score); got != tt.want {
+				t.Errorf("eloChange(%g, %g, %g) = %g, want %g", tt.rating, tt.opponent, tt.score, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEloChangeIsZeroSum(t *testing.T) {
+	for _, score := range []float64{0, 0.5, 1} {
+		a := eloChange(1350, 1180, score)
+		b := eloChange(1180, 1350, 1-score)
+		if a+b != 0 {
+			t.Errorf("score %g: changes %g and %g don't cancel out", score, a, b)
+		}
+	}
+}
+
+func TestRatingOf(t *testing.T) {
+	tests := []struct {
+		rating float64
+		want   float64
+	}{
+		{0, defaultRating},
+		{-5, defaultRating},
+		{1432, 1432},
+	}
+
+	for _, tt := range tests {
+		if got := ratingOf(&PlayerData{Rating: tt.rating}); got != tt.want {
+			t.Errorf("ratingOf(rating %g) = %g, want %g", tt.rating, got, tt.want)
+		}
+	}
+}
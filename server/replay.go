@@ -0,0 +1,427 @@
+// replay.go
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Replay event types. Everything that changes a match's state is recorded,
+// so playing the events back against the initial snapshot and seed
+// reproduces the match exactly.
+const (
+	ReplayTick    = "tick"    // one second of mana regeneration
+	ReplayCommand = "command" // a player action such as "attack 1 guard1"
+	ReplayTimeout = "timeout" // the game clock ran out
+	ReplayForfeit = "forfeit" // Player did not reconnect in time
+)
+
+const (
+	replaysDir      = "replays"
+	maxReplaySpeed  = 20.0
+	replayListLimit = 10
+)
+
+// ReplayEvent is one entry of a match log
+type ReplayEvent struct {
+	At      float64 `json:"at"` // seconds since the match started
+	Type    string  `json:"type"`
+	Player  int     `json:"player,omitempty"`
+	Command string  `json:"command,omitempty"`
+}
+
+// MatchReplay is everything needed to re-simulate a finished match
+type MatchReplay struct {
+	MatchID   string         `json:"match_id"`
+	Mode      string         `json:"mode"`
+	Seed      int64          `json:"seed"`
+	Practice  bool           `json:"practice,omitempty"` // against a bot
+	StartedAt time.Time      `json:"started_at"`
+	EndedAt   time.Time      `json:"ended_at"`
+	Initial   *GameState     `json:"initial"` // state before decks were validated
+	Templates *GameTemplates `json:"templates"`
+	Events    []ReplayEvent  `json:"events"`
+}
+
+// replayRecorder collects a live match's log; the match's stateMux guards it
+type replayRecorder struct {
+	replay  *MatchReplay
+	started time.Time
+}
+
+// newReplayRecorder snapshots the match's initial state. Caller must hold stateMux.
+func newReplayRecorder(m *Match) *replayRecorder {
+	now := time.Now()
+	return &replayRecorder{
+		replay: &MatchReplay{
+			MatchID:   m.ID,
+			Mode:      m.mode,
+			Seed:      m.seed,
+			Practice:  m.practice,
+			StartedAt: now,
+			Initial:   cloneGameState(m.state),
+			Templates: m.templates,
+		},
+		started: now,
+	}
+}
+
+// cloneGameState deep-copies a game state without the players' password hashes
+func cloneGameState(state *GameState) *GameState {
+	data, err := json.Marshal(state)
+	if err != nil {
+		log.Printf("Error snapshotting game state: %v", err)
+		return nil
+	}
+
+	var clone GameState
+	if err := json.Unmarshal(data, &clone); err != nil {
+		log.Printf("Error snapshotting game state: %v", err)
+		return nil
+	}
+	for _, player := range []*PlayerData{clone.Player1, clone.Player2} {
+		if player != nil {
+			player.Password = ""
+		}
+	}
+	return &clone
+}
+
+// record appends an event to the match log. Caller must hold stateMux.
+func (m *Match) record(eventType string, player int, command string) {
+	if m.recorder == nil {
+		return
+	}
+	m.recorder.replay.Events = append(m.recorder.replay.Events, ReplayEvent{
+		At:      time.Since(m.recorder.started).Seconds(),
+		Type:    eventType,
+		Player:  player,
+		Command: command,
+	})
+}
+
+// saveReplay writes the finished match log to the replays directory
+func (m *Match) saveReplay() {
+	if m.recorder == nil {
+		return
+	}
+	replay := m.recorder.replay
+	replay.EndedAt = time.Now()
+
+	if err := os.MkdirAll(replaysDir, 0755); err != nil {
+		fmt.Printf("Error creating replays directory: %v\n", err)
+		return
+	}
+
+	data, err := json.MarshalIndent(replay, "", "  ")
+	if err != nil {
+		fmt.Printf("Error marshaling replay of match #%s: %v\n", m.ID, err)
+		return
+	}
+
+	if err := writeFileAtomic(replayPath(m.ID), data, 0644); err != nil {
+		fmt.Printf("Error saving replay of match #%s: %v\n", m.ID, err)
+		return
+	}
+	log.Printf("Match #%s: replay saved (%d events)", m.ID, len(replay.Events))
+}
+
+// replayPath returns the file holding a match's replay
+func replayPath(matchID string) string {
+	return filepath.Join(replaysDir, "match_"+matchID+".json")
+}
+
+// loadReplay reads a saved replay by match ID
+func loadReplay(matchID string) (*MatchReplay, error) {
+	if _, err := strconv.Atoi(matchID); err != nil {
+		return nil, fmt.Errorf("invalid match ID '%s'", matchID)
+	}
+
+	data, err := os.ReadFile(replayPath(matchID))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no replay for match #%s", matchID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var replay MatchReplay
+	if err := json.Unmarshal(data, &replay); err != nil {
+		return nil, fmt.Errorf("replay of match #%s is corrupt: %v", matchID, err)
+	}
+	if err := migrateReplayTemplates(&replay); err != nil {
+		return nil, fmt.Errorf("replay of match #%s: %v", matchID, err)
+	}
+	if replay.Initial == nil || replay.Initial.Player1 == nil || replay.Initial.Player2 == nil {
+		return nil, fmt.Errorf("replay of match #%s has no initial state", matchID)
+	}
+	return &replay, nil
+}
+
+// migrateReplayTemplates upgrades the templates saved with an older replay so
+// it plays back under the current engine
+func migrateReplayTemplates(replay *MatchReplay) error {
+	if replay.Templates == nil || replay.Templates.Version == templatesSchemaVersion {
+		return nil
+	}
+
+	data, err := json.Marshal(replay.Templates)
+	if err != nil {
+		return err
+	}
+	migrated, _, err := migrateData("templates of match #"+replay.MatchID, data, templateMigrations)
+	if err != nil {
+		return err
+	}
+
+	var templates GameTemplates
+	if err := json.Unmarshal(migrated, &templates); err != nil {
+		return err
+	}
+	replay.Templates = &templates
+	return nil
+}
+
+// savedReplayIDs returns the IDs of all saved replays, newest first
+func savedReplayIDs() []int {
+	entries, err := os.ReadDir(replaysDir)
+	if err != nil {
+		return nil
+	}
+
+	var ids []int
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, "match_") || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		id, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, "match_"), ".json"))
+		if err == nil {
+			ids = append(ids, id)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(ids)))
+	return ids
+}
+
+// lastReplayID returns the highest match ID already saved, so IDs stay unique across restarts
+func lastReplayID() int {
+	if ids := savedReplayIDs(); len(ids) > 0 {
+		return ids[0]
+	}
+	return 0
+}
+
+// handleReplayCommand processes "replay", "replay <id> [speed]" and "replay stop"
+func (s *Server) handleReplayCommand(client *Client, args []string) {
+	if len(args) == 0 {
+		s.listReplays(client)
+		return
+	}
+
+	if args[0] == "stop" {
+		if client.watching.CompareAndSwap(true, false) {
+			client.Send("⏹️ Replay stopped.\n")
+		} else {
+			client.SendError("❌ You are not watching a replay.\n")
+		}
+		return
+	}
+
+	if match, _ := client.Match(); match != nil && match.isActive() {
+		client.SendError("❌ You can't watch a replay during a match.\n")
+		return
+	}
+
+	speed := 1.0
+	if len(args) > 1 {
+		value, err := strconv.ParseFloat(strings.TrimSuffix(args[1], "x"), 64)
+		if err != nil || value <= 0 || value > maxReplaySpeed {
+			client.SendError(fmt.Sprintf("❌ Speed must be a number between 0 and %.0f (e.g. 2 or 4x).\n", maxReplaySpeed))
+			return
+		}
+		speed = value
+	}
+
+	replay, err := loadReplay(strings.TrimPrefix(args[0], "#"))
+	if err != nil {
+		client.SendError(fmt.Sprintf("❌ %s\n", capitalize(err.Error())))
+		return
+	}
+
+	if !client.watching.CompareAndSwap(false, true) {
+		client.SendError("❌ You are already watching a replay. Type 'replay stop' first.\n")
+		return
+	}
+	go s.playReplay(client, replay, speed)
+}
+
+// listReplays shows the most recent saved replays
+func (s *Server) listReplays(client *Client) {
+	ids := savedReplayIDs()
+	if len(ids) > replayListLimit {
+		ids = ids[:replayListLimit]
+	}
+
+	entries := make([]ReplayListEntry, 0, len(ids))
+	output := "📼 Recent replays:\n"
+	for _, id := range ids {
+		replay, err := loadReplay(strconv.Itoa(id))
+		if err != nil {
+			continue
+		}
+		entries = append(entries, ReplayListEntry{
+			MatchID:   replay.MatchID,
+			Player1:   replay.Initial.Player1.Username,
+			Player2:   replay.Initial.Player2.Username,
+			Mode:      replay.Mode,
+			StartedAt: replay.StartedAt,
+		})
+		output += fmt.Sprintf("  #%-4d %s vs %s (%s) - %s\n", id,
+			replay.Initial.Player1.Username, replay.Initial.Player2.Username,
+			modeName(replay.Mode), replay.StartedAt.Format("2006-01-02 15:04"))
+	}
+	output += "💡 Use: replay <id> [speed]\n"
+	if len(entries) == 0 {
+		output = "📼 No replays saved yet.\n"
+	}
+	client.SendEvent(MsgReplayList, ReplayListMessage{Replays: entries}, output)
+}
+
+// discardConn swallows everything written to it
+type discardConn struct {
+	net.Conn
+}
+
+func (discardConn) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+// newPlaybackMatch rebuilds a recorded match. The viewer watches from player 1's
+// side; nothing the playback does is saved.
+func newPlaybackMatch(s *Server, replay *MatchReplay, viewer *Client) *Match {
+	p1 := &Client{Username: replay.Initial.Player1.Username, conn: viewer.conn}
+	p2 := &Client{Username: replay.Initial.Player2.Username, conn: discardConn{}}
+	if viewer.isJSON() {
+		p1.setProtocol(ProtocolJSON)
+	}
+
+	m := newMatch(s, replay.MatchID, replay.Mode, replay.Seed, p1, p2)
+	m.playback = true
+	m.practice = replay.Practice
+	m.templates = replay.Templates
+	if m.templates == nil {
+		m.templates = &GameTemplates{}
+	}
+	damage, err := newDamageModel(m.templates.Damage)
+	if err != nil {
+		damage = defaultDamageModel()
+	}
+	m.damage = damage
+
+	m.state = replay.Initial
+	m.state.GameStartTime = time.Now()
+	m.prepareDecks()
+	m.resetTurnClock()
+	m.resetUnitsHP()
+	return m
+}
+
+// playReplay re-simulates a recorded match and streams it to the viewer
+func (s *Server) playReplay(viewer *Client, replay *MatchReplay, speed float64) {
+	defer viewer.watching.Store(false)
+
+	m := newPlaybackMatch(s, replay, viewer)
+	status := ReplayMessage{
+		MatchID: replay.MatchID,
+		Player1: replay.Initial.Player1.Username,
+		Player2: replay.Initial.Player2.Username,
+		Mode:    replay.Mode,
+		Seed:    replay.Seed,
+		Speed:   speed,
+	}
+
+	header := fmt.Sprintf("\n📼 REPLAY of match #%s (%s, seed %d) at %gx speed\n",
+		replay.MatchID, modeName(replay.Mode), replay.Seed, speed)
+	header += fmt.Sprintf("Players: %s vs %s - watching from %s's side\n", status.Player1, status.Player2, status.Player1)
+	header += "Type 'replay stop' to stop watching.\n"
+	viewer.SendEvent(MsgReplay, status, header)
+
+	elapsed := 0.0
+	for _, event := range replay.Events {
+		if wait := event.At - elapsed; wait > 0 {
+			time.Sleep(time.Duration(wait / speed * float64(time.Second)))
+		}
+		elapsed = event.At
+
+		// Stop when the viewer leaves, starts a match or cancels
+		if !viewer.watching.Load() || !s.isOnline(viewer) {
+			return
+		}
+		if match, _ := viewer.Match(); match != nil && match.isActive() {
+			return
+		}
+
+		m.applyReplayEvent(event)
+	}
+
+	status.Finished = true
+	viewer.SendEvent(MsgReplay, status, fmt.Sprintf("📼 Replay of match #%s finished.\n", replay.MatchID))
+}
+
+// applyReplayEvent performs one recorded event on a playback match
+func (m *Match) applyReplayEvent(event ReplayEvent) {
+	switch event.Type {
+	case ReplayTick:
+		m.regenerateMana()
+
+	case ReplayCommand:
+		parts := strings.Fields(event.Command)
+		if len(parts) == 0 || event.Player < 1 || event.Player > 2 {
+			return
+		}
+		client := m.players[event.Player-1]
+
+		switch parts[0] {
+		case "attack":
+			if len(parts) != 3 {
+				return
+			}
+			troopIdx, err := strconv.Atoi(parts[1])
+			if err != nil || troopIdx < 1 || troopIdx > len(m.deck(event.Player)) {
+				return
+			}
+			m.processAttackWithTurns(client, event.Player, troopIdx-1, parts[2])
+		case "pass":
+			m.processPass(client, event.Player)
+		case "surrender":
+			m.processSurrender(client, event.Player)
+		case "offer":
+			m.processDrawOffer(client, event.Player)
+		case "accept":
+			m.processAcceptDraw(client, event.Player)
+		}
+
+	case ReplayTimeout:
+		m.stateMux.Lock()
+		if m.state.IsGameActive {
+			m.handleGameTimeout()
+		}
+		m.stateMux.Unlock()
+
+	case ReplayForfeit:
+		m.stateMux.Lock()
+		if m.state.IsGameActive {
+			m.forfeitDisconnected(event.Player)
+		}
+		m.stateMux.Unlock()
+	}
+}
@@ -0,0 +1,106 @@
+// replay_test.go
+package main
+
+import "testing"
+
+// towerHP returns the HP of both players' towers, keyed by owner and position
+func towerHP(state *GameState) map[string]float64 {
+	hp := make(map[string]float64)
+	for _, player := range []*PlayerData{state.Player1, state.Player2} {
+		for _, position := range towerPositions {
+			if tower := player.Towers[position]; tower != nil {
+				hp[player.Username+" "+position] = tower.HP
+			}
+		}
+	}
+	return hp
+}
+
+// TestReplayReproducesMatch plays a scripted match, then plays its saved log
+// back and checks the playback ends the same way
+func TestReplayReproducesMatch(t *testing.T) {
+	s := newTestServer(t, "alice", "bob")
+	// Weak towers so the scripted attacks can destroy a king
+	for i := range s.templates.Towers {
+		s.templates.Towers[i].HP = 300
+		s.templates.Towers[i].ATK = 150
+		s.templates.Towers[i].DEF = 100
+	}
+	alice, aliceConn := newTestClient(s, "alice")
+	bob, _ := newTestClient(s, "bob")
+	alice.setProtocol(ProtocolJSON)
+
+	match := s.registerMatch(alice, bob, ModeTurnBased)
+	match.start()
+	defer match.finish()
+
+	clients := [2]*Client{alice, bob}
+	for step := 0; step < 60 && match.isActive(); step++ {
+		// The same mana every turn, recorded as ticks like the live clock
+		for i := 0; i < 3; i++ {
+			match.submit(match.regenerateMana)
+		}
+
+		// The player to move attacks the first standing tower, cycling
+		// through their troops; knocked out troops just waste the command
+		match.stateMux.RLock()
+		playerNum := match.state.Turn
+		defender := match.state.Player2
+		if playerNum == 2 {
+			defender = match.state.Player1
+		}
+		target := ""
+		for _, position := range towerPositions {
+			if defender.Towers[position].HP > 0 {
+				target = position
+				break
+			}
+		}
+		match.stateMux.RUnlock()
+
+		slot := step % deckSize
+		client := clients[playerNum-1]
+		match.submit(func() { match.processAttackWithTurns(client, playerNum, slot, target) })
+	}
+	if match.isActive() {
+		match.submit(func() { match.processSurrender(bob, 2) })
+	}
+	if match.isActive() {
+		t.Fatal("the scripted match didn't end")
+	}
+
+	live := gameOver(t, aliceConn)
+	match.stateMux.RLock()
+	liveHP := towerHP(match.state)
+	match.stateMux.RUnlock()
+
+	replay, err := loadReplay(match.ID)
+	if err != nil {
+		t.Fatalf("loadReplay() error = %v", err)
+	}
+	if len(replay.Events) == 0 {
+		t.Fatal("the replay has no events")
+	}
+
+	viewerConn := &recordConn{}
+	viewer := &Client{Username: "viewer", conn: viewerConn}
+	viewer.setProtocol(ProtocolJSON)
+	playback := newPlaybackMatch(s, replay, viewer)
+	for _, event := range replay.Events {
+		playback.applyReplayEvent(event)
+	}
+
+	if playback.isActive() {
+		t.Fatal("the playback didn't end")
+	}
+	replayed := gameOver(t, viewerConn)
+	if replayed.Winner != live.Winner || replayed.Draw != live.Draw {
+		t.Errorf("playback winner = %q (draw %v), live winner = %q (draw %v)",
+			replayed.Winner, replayed.Draw, live.Winner, live.Draw)
+	}
+	for tower, hp := range liveHP {
+		if got := towerHP(playback.state)[tower]; got != hp {
+			t.Errorf("%s: playback HP = %g, live HP = %g", tower, got, hp)
+		}
+	}
+}
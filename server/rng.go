@@ -0,0 +1,25 @@
+// rng.go
+package main
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"math/rand"
+	"time"
+)
+
+// newSeed returns a fresh seed for a match or a one-off random choice
+func newSeed() int64 {
+	var buf [8]byte
+	if _, err := crand.Read(buf[:]); err != nil {
+		return time.Now().UnixNano()
+	}
+	return int64(binary.LittleEndian.Uint64(buf[:]) >> 1)
+}
+
+// newRand creates a random source that always produces the same sequence for
+// the same seed. Each match owns one, so a recorded seed and the same inputs
+// reproduce the same crits and outcome.
+func newRand(seed int64) *rand.Rand {
+	return rand.New(rand.NewSource(seed))
+}
@@ -6,29 +6,99 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"regexp"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-// Server manages client connections and game state
+// Server manages client connections and running matches
 type Server struct {
-	listener     net.Listener
-	clients      map[string]net.Conn
-	clientsMux   sync.RWMutex
-	gameState    *GameState
-	gameStateMux sync.RWMutex
-	playerData   map[string]*PlayerData
-	dataMux      sync.RWMutex
+	listener    net.Listener
+	clients     map[string]*Client
+	clientsMux  sync.RWMutex
+	matchmaker  *Matchmaker
+	matches     map[string]*Match
+	matchesMux  sync.RWMutex
+	nextMatchID int
+	history     *MatchHistory
+	store       PlayerStore
+	playerData  map[string]*PlayerData // cache of players loaded from the store
+	dataMux     sync.RWMutex
+	ratings     *ratingIndex    // leaderboard ratings of every account
+	registerMux sync.Mutex      // serializes account creation
+	pairingMux  sync.Mutex      // serializes putting clients into matches
+	admins      map[string]bool // lowercased usernames allowed to run admin commands
+	chatFilter  *regexp.Regexp  // words masked in chat; nil when no filter is configured
+
+	templates        *GameTemplates // balance data used by new matches
+	templatesModTime time.Time      // modification time of the last loaded file
+	templatesMux     sync.RWMutex
 }
 
-// NewServer creates a new server instance
-func NewServer() *Server {
-	return &Server{
-		clients:    make(map[string]net.Conn),
+// Client is a connection, its negotiated protocol and the match it is playing in
+type Client struct {
+	Username   string
+	conn       net.Conn
+	protocol   string
+	writeMux   sync.Mutex
+	match      *Match
+	playerNum  int
+	matchMux   sync.RWMutex
+	watching   atomic.Bool // streaming a replay
+	bot        *Bot        // non-nil for a server-side bot player
+	spectating *Match      // live match watched read-only, guarded by matchMux
+
+	chatMux   sync.Mutex
+	chatTimes []time.Time     // recent chat messages, for the rate limit
+	muted     map[string]bool // usernames whose chat is hidden
+}
+
+// Match returns the client's current match and player number
+func (c *Client) Match() (*Match, int) {
+	c.matchMux.RLock()
+	defer c.matchMux.RUnlock()
+
+	return c.match, c.playerNum
+}
+
+// inMatch reports whether the client belongs to a match that hasn't finished,
+// including one that is about to start
+func (c *Client) inMatch() bool {
+	match, _ := c.Match()
+	return match != nil && !match.isOver()
+}
+
+// setMatch attaches the client to a match as the given player number
+func (c *Client) setMatch(match *Match, playerNum int) {
+	c.matchMux.Lock()
+	defer c.matchMux.Unlock()
+
+	c.match = match
+	c.playerNum = playerNum
+}
+
+// NewServer creates a new server instance backed by a player store
+func NewServer(store PlayerStore, admins []string) *Server {
+	s := &Server{
+		store:      store,
+		admins:     make(map[string]bool),
+		clients:    make(map[string]*Client),
+		matches:    make(map[string]*Match),
 		playerData: make(map[string]*PlayerData),
+		history:    NewMatchHistory(historyFile),
+		ratings:    newRatingIndex(store),
 	}
+	s.matchmaker = NewMatchmaker(s)
+	s.nextMatchID = lastReplayID() // keep match IDs unique across restarts
+	for _, admin := range admins {
+		if admin = strings.TrimSpace(admin); admin != "" {
+			s.admins[strings.ToLower(admin)] = true
+		}
+	}
+	return s
 }
 
 // Start begins listening for client connections
@@ -41,6 +111,9 @@ func (s *Server) Start(port string) error {
 	s.listener = listener
 	fmt.Printf("TCR Server started on port %s\n", port)
 
+	go s.matchmaker.run()
+	go s.watchTemplates()
+
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
@@ -58,114 +131,229 @@ func (s *Server) handleClient(conn net.Conn) {
 	defer conn.Close()
 
 	scanner := bufio.NewScanner(conn)
-	var username string
-	var playerNum int
+	client := &Client{conn: conn, protocol: ProtocolText}
 
 	// ĐỢI MỘT CHÚT ĐỂ CLIENT SẴN SÀNG, RỒIMỚI GỬI PROMPT
 	time.Sleep(500 * time.Millisecond)
 
 	// GỬI USERNAME PROMPT VỚI NEWLINE
 	log.Println("Sending username prompt to client")
-	conn.Write([]byte("Enter username: \n"))
+	client.SendEvent(MsgPrompt, "username", usernamePrompt)
 
 	// Đọc username
 	log.Println("Waiting for username input")
-	if !scanner.Scan() {
+	input, ok := s.readInput(client, scanner)
+	if !ok {
 		log.Println("Failed to read username")
 		return
 	}
-	username = strings.TrimSpace(scanner.Text())
-	log.Printf("Received username: '%s'", username)
 
-	// Gửi password prompt
-	log.Println("Sending password prompt")
-	conn.Write([]byte("Enter password: \n"))
+	// The first line may negotiate the wire protocol instead of a username
+	if protocol, found := strings.CutPrefix(strings.ToLower(input), "protocol "); found {
+		protocol = strings.TrimSpace(protocol)
+		if protocol != ProtocolText && protocol != ProtocolJSON {
+			client.SendError(fmt.Sprintf("Unsupported protocol %q. Use 'text' or 'json'.\n", protocol))
+			return
+		}
 
-	// Đọc password
-	log.Println("Waiting for password input")
-	if !scanner.Scan() {
-		log.Println("Failed to read password")
-		return
+		client.setProtocol(protocol)
+		log.Printf("Client %s negotiated %s protocol", conn.RemoteAddr(), protocol)
+		client.SendEvent(MsgProtocol, protocol, fmt.Sprintf("Protocol set to %s.\n", protocol))
+		client.SendEvent(MsgPrompt, "username", usernamePrompt)
+
+		input, ok = s.readInput(client, scanner)
+		if !ok {
+			log.Println("Failed to read username")
+			return
+		}
 	}
-	password := strings.TrimSpace(scanner.Text())
-	log.Printf("Received password: '%s'", password)
 
-	// Authenticate
-	player := s.authenticatePlayer(username, password)
+	// Login or register
+	player := s.signIn(client, scanner, input)
 	if player == nil {
-		conn.Write([]byte("Authentication failed!\n"))
 		return
 	}
+	username := player.Username
 
 	// WELCOME MESSAGE SAU KHI ĐĂNG NHẬP THÀNH CÔNG
-	conn.Write([]byte("╔══════════════════════════════════════╗\n"))
-	conn.Write([]byte("║     Text-Based Clash Royale Server   ║\n"))
-	conn.Write([]byte("║              TCR v2.0                ║\n"))
-	conn.Write([]byte("╚══════════════════════════════════════╝\n"))
-
-	welcomeMsg := fmt.Sprintf("Welcome %s! Level: %d, EXP: %.0f\n",
-		username, player.Level, player.EXP)
-	conn.Write([]byte(welcomeMsg))
-
-	// Add to clients and determine player number
+	welcome := "╔══════════════════════════════════════╗\n"
+	welcome += "║     Text-Based Clash Royale Server   ║\n"
+	welcome += "║              TCR v2.0                ║\n"
+	welcome += "╚══════════════════════════════════════╝\n"
+	welcome += fmt.Sprintf("Welcome %s! Level: %d, EXP: %.0f, Rating: %.0f\n",
+		username, player.Level, player.EXP, ratingOf(player))
+	client.SendEvent(MsgWelcome, WelcomeMessage{
+		Username: username,
+		Level:    player.Level,
+		EXP:      player.EXP,
+		Rating:   ratingOf(player),
+	}, welcome)
+
+	client.Username = username
+	client.setMutes(player.Muted)
+
+	// Register client; one connection per account. A connection that dropped
+	// without a clean close can linger until TCP notices, so a login with the
+	// right password takes over the old session and its held match slot.
 	s.clientsMux.Lock()
-	s.clients[username] = conn
-	clientCount := len(s.clients)
-
-	if clientCount == 1 {
-		playerNum = 1
-		conn.Write([]byte("Waiting for opponent...\n"))
-		s.clientsMux.Unlock()
-	} else if clientCount == 2 {
-		playerNum = 2
-		conn.Write([]byte("Game starting...\n"))
-		s.clientsMux.Unlock()
-
-		time.Sleep(200 * time.Millisecond)
-		s.startNewGame()
-	} else {
-		s.clientsMux.Unlock()
-		conn.Write([]byte("Game is full. Please wait for next round.\n"))
-		return
+	stale := s.clients[username]
+	s.clients[username] = client
+	s.clientsMux.Unlock()
+	if stale != nil {
+		log.Printf("%s logged in again, closing the previous session", username)
+		stale.SendError("⚠️ Your account logged in from another connection.\n")
+		stale.conn.Close()
+		s.removeClient(stale)
 	}
 
 	// CHỈ GỬI HELP SAU KHI ĐÃ VÀO GAME
-	s.sendHelp(conn)
+	s.sendHelp(client)
+
+	// Resume a held match slot, otherwise look for a new match
+	if match, playerNum := s.findHeldSlot(username); match == nil || !match.reconnect(client, playerNum) {
+		s.joinQueue(client, ModeTurnBased)
+	}
 
 	// Game command loop
-	for scanner.Scan() {
-		input := strings.TrimSpace(scanner.Text())
+	for {
+		input, ok := s.readInput(client, scanner)
+		if !ok {
+			break
+		}
 		if input == "" {
 			continue
 		}
 
 		if strings.ToLower(input) == "quit" {
-			conn.Write([]byte("Thanks for playing! Goodbye!\n"))
+			client.Send("Thanks for playing! Goodbye!\n")
 			break
 		}
 
-		s.processCommand(conn, playerNum, username, input)
+		s.processCommand(client, input)
 	}
 
 	// Clean up on disconnect
-	s.removeClient(username)
+	s.removeClient(client)
+}
+
+// readInput reads the next line from the client, decoding it per the negotiated
+// protocol. Malformed lines are reported and skipped; ok is false on disconnect.
+func (s *Server) readInput(client *Client, scanner *bufio.Scanner) (string, bool) {
+	for scanner.Scan() {
+		input, err := client.decodeInput(scanner.Text())
+		if err != nil {
+			client.SendError(fmt.Sprintf("❌ %v\n", err))
+			continue
+		}
+		return input, true
+	}
+	return "", false
 }
 
 // processCommand handles client commands
-func (s *Server) processCommand(conn net.Conn, playerNum int, username string, input string) {
+func (s *Server) processCommand(client *Client, input string) {
 	command := strings.ToLower(input)
 	parts := strings.Split(command, " ")
+	match, playerNum := client.Match()
 
 	switch parts[0] {
 	case "help":
-		s.sendHelp(conn)
+		s.sendHelp(client)
+
+	case "play":
+		mode := ModeTurnBased
+		if len(parts) > 1 {
+			mode = parts[1]
+		}
+		if !validMode(mode) {
+			client.SendError(fmt.Sprintf("❌ Unknown mode '%s'. Use 'play turn' or 'play realtime'.\n", mode))
+			return
+		}
+		s.joinQueue(client, mode)
+
+	case "leave":
+		if s.matchmaker.remove(client) {
+			client.Send("👋 You left the matchmaking queue. Type 'play' to search again.\n")
+		} else {
+			client.SendError("❌ You are not in the matchmaking queue.\n")
+		}
+
+	case "queue":
+		s.matchmaker.sendStatus(client)
+
+	case "deck":
+		s.handleDeckCommand(client, parts[1:])
+
+	case "history":
+		s.showHistory(client)
+
+	case "stats":
+		username := client.Username
+		if len(parts) > 1 {
+			username = strings.Fields(input)[1]
+		}
+		s.showStats(client, username)
+
+	case "leaderboard":
+		s.showLeaderboard(client, parts[1:])
+
+	case "replay":
+		s.handleReplayCommand(client, parts[1:])
+
+	case "reload":
+		s.handleReloadCommand(client)
+
+	case "practice":
+		s.handlePracticeCommand(client, parts[1:])
+
+	case "say":
+		s.handleSayCommand(client, input)
+
+	case "all":
+		s.handleAllCommand(client, input)
+
+	case "whisper":
+		s.handleWhisperCommand(client, input)
+
+	case "mute", "unmute":
+		s.handleMuteCommand(client, strings.Fields(input)[1:], parts[0] == "mute")
+
+	case "pass", "surrender", "accept":
+		s.handleMatchAction(client, parts[0])
+
+	case "offer":
+		if len(parts) != 2 || parts[1] != "draw" {
+			client.SendError("Usage: offer draw\n")
+			return
+		}
+		s.handleMatchAction(client, "offer draw")
+
+	case "spectate":
+		s.handleSpectateCommand(client, parts[1:])
 
 	case "status":
-		s.displayGameState(conn, playerNum)
+		if watched := client.Spectating(); watched != nil {
+			watched.displaySpectatorState(client)
+			return
+		}
+		if match == nil {
+			client.SendError("❌ Game not started yet.\n")
+			return
+		}
+		match.displayGameState(client, playerNum)
 
 	case "attack":
-		if !s.isPlayerTurn(playerNum) {
-			s.notifyNotYourTurn(conn, playerNum)
+		if client.Spectating() != nil {
+			client.SendError("👀 Spectators can't issue game commands. Type 'spectate stop' to leave.\n")
+			return
+		}
+		if match == nil {
+			client.SendError("❌ Game not started.\n")
+			return
+		}
+
+		if !match.isPlayerTurn(playerNum) {
+			match.notifyNotYourTurn(client, playerNum)
 			return
 		}
 
@@ -173,132 +361,195 @@ func (s *Server) processCommand(conn net.Conn, playerNum int, username string, i
 			troopIdx, err := strconv.Atoi(parts[1])
 			target := strings.ToLower(parts[2])
 
-			if err == nil && troopIdx >= 1 && troopIdx <= 3 {
-				s.processAttackWithTurns(conn, playerNum, troopIdx-1, target)
+			if slots := len(match.deck(playerNum)); err == nil && troopIdx >= 1 && troopIdx <= slots {
+				// Attacks run on the match's event loop, one at a time
+				if !match.submit(func() {
+					match.processAttackWithTurns(client, playerNum, troopIdx-1, target)
+				}) {
+					client.SendError("❌ Game is not active.\n")
+				}
 			} else {
-				conn.Write([]byte("Invalid troop index. Use 1-3.\n"))
+				client.SendError(fmt.Sprintf("Invalid troop index. Use 1-%d.\n", slots))
 			}
 		} else {
-			conn.Write([]byte("Usage: attack <troop_index> <target>\n"))
+			client.SendError("Usage: attack <troop_index> <target>\n")
 		}
 
 	default:
-		conn.Write([]byte("Unknown command. Type 'help' for available commands.\n"))
+		client.SendError("Unknown command. Type 'help' for available commands.\n")
 	}
 }
 
 // sendHelp displays available commands
-func (s *Server) sendHelp(conn net.Conn) {
+func (s *Server) sendHelp(client *Client) {
 	help := `
 ╔═══════════════ TCR Commands ════════════════╗
 ║ status          - Show current game state   ║
 ║ attack <1-3> <target> - Attack with troop   ║
 ║                       Targets: king,        ║
 ║                       guard1, guard2        ║
+║ pass            - Skip your turn, keep mana ║
+║ surrender       - Resign the current match  ║
+║ offer draw      - Propose a draw            ║
+║ accept          - Accept a draw offer       ║
+║ play [turn|realtime] - Join matchmaking     ║
+║ queue           - Show queue position/wait  ║
+║ leave           - Leave matchmaking queue   ║
+║ practice [easy|medium|hard] - Play a bot    ║
+║ deck [show]     - Show deck and collection  ║
+║ deck set <a> <b> <c> - Choose deck troops   ║
+║ deck swap <slot> <troop> - Swap one troop   ║
+║ history         - Show your recent matches  ║
+║ stats [user]    - Show win rate and damage  ║
+║ leaderboard [N] - Show the top N players    ║
+║ replay [id] [speed] - List or watch replays ║
+║ replay stop     - Stop watching a replay    ║
+║ spectate [id]   - List or watch live games  ║
+║ spectate stop   - Stop spectating           ║
+║ say <msg>       - Chat in your match        ║
+║ all <msg>       - Chat with everyone online ║
+║ whisper <user> <msg> - Private message      ║
+║ mute [user]     - Mute a player or list     ║
+║ unmute <user>   - Hear a muted player again ║
+║ reload          - Reload templates (admin)  ║
 ║ quit            - Leave the game            ║
 ║ help            - Show this help            ║
 ╠═════════════════════════════════════════════╣
-║ Turn-Based Rules:                           ║
+║ Turn-Based Rules (play turn):               ║
 ║ • Each player takes turns                   ║
 ║ • One attack per turn                       ║
 ║ • Destroy a tower = get bonus turn          ║
+║ • An idle turn passes when time runs out    ║
+║ • Idling turn after turn forfeits the match ║
+║ Real-Time Rules (play realtime):            ║
+║ • Attack any time you have enough mana      ║
+║ • Mana regenerates 1 per second             ║
+║ Both modes:                                 ║
 ║ • Must destroy guard towers before king     ║
 ║ • Game lasts 3 minutes                      ║
 ╚═════════════════════════════════════════════╝
 `
-	conn.Write([]byte(help))
+	client.SendEvent(MsgHelp, strings.TrimSpace(help), help)
 }
 
-// removeClient handles client disconnection
-func (s *Server) removeClient(username string) {
-	s.clientsMux.Lock()
-	defer s.clientsMux.Unlock()
-
-	delete(s.clients, username)
+// joinQueue puts a client into matchmaking for a game mode unless they are already playing
+func (s *Server) joinQueue(client *Client, mode string) {
+	if client.inMatch() {
+		client.SendError("❌ You are already in a match.\n")
+		return
+	}
 
-	// If game was active, end it
-	s.gameStateMux.Lock()
-	if s.gameState != nil && s.gameState.IsGameActive {
-		s.gameState.IsGameActive = false
-		s.broadcastToAll("Game ended due to player disconnect.\n")
+	if player := s.loadPlayerData(client.Username); player != nil {
+		if err := validateDeck(player, player.Deck); err != nil {
+			client.SendError(fmt.Sprintf("❌ Your deck is invalid: %v\n💡 Fix it with 'deck set' before playing.\n", err))
+			return
+		}
 	}
-	s.gameStateMux.Unlock()
+	// The index is safe to read while a match that just ended updates ratings
+	s.matchmaker.enqueue(client, int(s.ratings.rating(client.Username)), mode)
 }
 
-// startNewGame initializes a new game session
-func (s *Server) startNewGame() {
+// isOnline reports whether the client is still connected
+func (s *Server) isOnline(client *Client) bool {
 	s.clientsMux.RLock()
-	usernames := make([]string, 0, 2)
-	for username := range s.clients {
-		usernames = append(usernames, username)
-	}
-	s.clientsMux.RUnlock()
+	defer s.clientsMux.RUnlock()
 
-	if len(usernames) != 2 {
-		return
-	}
+	return s.clients[client.Username] == client
+}
 
-	s.gameStateMux.Lock()
-	s.gameState = &GameState{
-		Player1:       s.loadPlayerData(usernames[0]),
-		Player2:       s.loadPlayerData(usernames[1]),
-		Player1Mana:   5,
-		Player2Mana:   5,
-		GameStartTime: time.Now(),
-		GameDuration:  180,
-		IsGameActive:  true,
-		Turn:          1,
+// removeClient handles client disconnection
+func (s *Server) removeClient(client *Client) {
+	s.clientsMux.Lock()
+	// A newer session may already have taken the username over
+	if s.clients[client.Username] == client {
+		delete(s.clients, client.Username)
 	}
-	s.gameStateMux.Unlock()
-
-	s.resetTowersHP()
+	s.clientsMux.Unlock()
 
-	s.broadcastToAll(fmt.Sprintf("🎮 GAME STARTED! 🎮\n"))
-	s.broadcastToAll(fmt.Sprintf("Players: %s vs %s\n", usernames[0], usernames[1]))
-	s.broadcastToAll(fmt.Sprintf("%s goes first!\n", usernames[0]))
-	s.broadcastToAll("3 minutes battle begins now!\n")
-	s.broadcastToAll("Type 'status' to see current game state.\n")
+	s.matchmaker.remove(client)
+	s.stopSpectating(client)
 
-	s.startManaRegeneration()
-	s.startGameTimer()
+	// If a match was active, hold the slot for a reconnect
+	if match, playerNum := client.Match(); match != nil {
+		match.playerDisconnected(client, playerNum)
+	}
 }
 
-// resetTowersHP resets all towers to full HP
-func (s *Server) resetTowersHP() {
-	s.gameStateMux.Lock()
-	defer s.gameStateMux.Unlock()
+// findHeldSlot finds a running match holding a slot for a disconnected username
+func (s *Server) findHeldSlot(username string) (*Match, int) {
+	for _, match := range s.runningMatches() {
+		if playerNum := match.heldSlot(username); playerNum != 0 {
+			return match, playerNum
+		}
+	}
+	return nil, 0
+}
 
-	if s.gameState == nil {
-		return
+// startMatch creates, registers and starts a new match for two clients
+func (s *Server) startMatch(player1, player2 *Client, mode string) *Match {
+	match := s.registerMatch(player1, player2, mode)
+	s.matchmaker.unpair(player1, player2)
+	if match == nil {
+		// One of them started a practice match after being paired
+		for _, player := range []*Client{player1, player2} {
+			if !player.inMatch() && s.isOnline(player) {
+				player.Send("⚠️ Your opponent is no longer available. Back to the queue.\n")
+				s.joinQueue(player, mode)
+			}
+		}
+		return nil
 	}
+	match.ranked = true // every queued match counts for the ladder
+
+	log.Printf("Match #%s started: %s vs %s (%s, seed %d)", match.ID, player1.Username, player2.Username, mode, match.seed)
+	match.start()
+	return match
+}
 
-	for _, tower := range s.gameState.Player1.Towers {
-		tower.HP = tower.MaxHP
+// registerMatch creates a match with a fresh ID and seed and adds it to the
+// running set. It returns nil if either client is already in a match.
+func (s *Server) registerMatch(player1, player2 *Client, mode string) *Match {
+	s.pairingMux.Lock()
+	defer s.pairingMux.Unlock()
+	if player1.inMatch() || player2.inMatch() {
+		return nil
 	}
 
-	for _, tower := range s.gameState.Player2.Towers {
-		tower.HP = tower.MaxHP
+	s.matchesMux.Lock()
+	s.nextMatchID++
+	match := newMatch(s, strconv.Itoa(s.nextMatchID), mode, newSeed(), player1, player2)
+	s.matches[match.ID] = match
+	s.matchesMux.Unlock()
+
+	// Players stop watching other matches once their own starts
+	for _, player := range []*Client{player1, player2} {
+		if s.stopSpectating(player) {
+			player.Send("⏹️ You stopped spectating: your match is starting.\n")
+		}
 	}
+
+	player1.setMatch(match, 1)
+	player2.setMatch(match, 2)
+	return match
 }
 
-// broadcastToAll sends message to all connected clients
-func (s *Server) broadcastToAll(message string) {
-	s.clientsMux.RLock()
-	defer s.clientsMux.RUnlock()
+// runningMatches returns a snapshot of the registered matches.
+// Callers must not hold matchesMux while taking a match's stateMux.
+func (s *Server) runningMatches() []*Match {
+	s.matchesMux.RLock()
+	defer s.matchesMux.RUnlock()
 
-	for _, conn := range s.clients {
-		conn.Write([]byte(message))
+	matches := make([]*Match, 0, len(s.matches))
+	for _, match := range s.matches {
+		matches = append(matches, match)
 	}
+	return matches
 }
 
-// broadcastToOthers sends message to all clients except sender
-func (s *Server) broadcastToOthers(sender net.Conn, message string) {
-	s.clientsMux.RLock()
-	defer s.clientsMux.RUnlock()
+// unregisterMatch removes a finished match from the running set
+func (s *Server) unregisterMatch(id string) {
+	s.matchesMux.Lock()
+	defer s.matchesMux.Unlock()
 
-	for _, conn := range s.clients {
-		if conn != sender {
-			conn.Write([]byte(message))
-		}
-	}
+	delete(s.matches, id)
 }
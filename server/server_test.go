@@ -0,0 +1,301 @@
+// server_test.go
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordConn is a connection that keeps everything written to it
+type recordConn struct {
+	net.Conn
+	mux sync.Mutex
+	out strings.Builder
+}
+
+func (c *recordConn) Write(b []byte) (int, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.out.Write(b)
+}
+
+func (c *recordConn) Close() error {
+	return nil
+}
+
+// output returns everything written so far
+func (c *recordConn) output() string {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.out.String()
+}
+
+// testPlayer builds an account like createNewPlayer, without the slow
+// password hash and with a fixed deck
+func testPlayer(username string, templates *GameTemplates) *PlayerData {
+	player := &PlayerData{
+		Username: username,
+		Password: "secret1",
+		Level:    1,
+		Rating:   defaultRating,
+		Towers:   defaultTowers(templates),
+	}
+	syncCollection(player, templates)
+	for _, troop := range templates.Troops[:deckSize] {
+		player.Deck = append(player.Deck, troop.Name)
+	}
+	return player
+}
+
+// newTestServer creates a server in a temporary directory with the default
+// templates and an account for each username
+func newTestServer(t *testing.T, usernames ...string) *Server {
+	t.Helper()
+	t.Chdir(t.TempDir())
+
+	store, err := openJSONStore("players.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	templates := defaultGameTemplates()
+	for _, username := range usernames {
+		if err := store.Put(testPlayer(username, templates)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := NewServer(store, nil)
+	s.templates = templates
+	return s
+}
+
+// newTestClient logs a client into the server
+func newTestClient(s *Server, username string) (*Client, *recordConn) {
+	conn := &recordConn{}
+	client := &Client{Username: username, conn: conn}
+
+	s.clientsMux.Lock()
+	s.clients[username] = client
+	s.clientsMux.Unlock()
+	return client, conn
+}
+
+// newTestMatch builds a running turn-based match between alice and bob,
+// without its event loop, at full mana and with every tower standing. Tests
+// drive it by calling the match's methods directly.
+func newTestMatch(t *testing.T) *Match {
+	t.Helper()
+	s := newTestServer(t, "alice", "bob")
+	alice, _ := newTestClient(s, "alice")
+	bob, _ := newTestClient(s, "bob")
+
+	m := newMatch(s, "1", ModeTurnBased, 1, alice, bob)
+	m.templates = s.templates
+	m.damage = defaultDamageModel()
+	m.state = &GameState{
+		Player1:      testPlayer("alice", s.templates),
+		Player2:      testPlayer("bob", s.templates),
+		Player1Mana:  maxMana,
+		Player2Mana:  maxMana,
+		IsGameActive: true,
+		Turn:         1,
+		Mode:         ModeTurnBased,
+	}
+	applyTemplates(m.state.Player1, m.templates)
+	applyTemplates(m.state.Player2, m.templates)
+	m.prepareDecks()
+	m.resetUnitsHP()
+	return m
+}
+
+// lastRecord returns the history record of a player's latest match, or nil
+func lastRecord(t *testing.T, s *Server, username string) *MatchRecord {
+	t.Helper()
+	records, err := s.history.forPlayer(username, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	return records[0]
+}
+
+// tick runs the match clock for some seconds, as the event loop's mana ticker does
+func tick(m *Match, seconds int) {
+	for i := 0; i < seconds; i++ {
+		m.regenerateMana()
+	}
+}
+
+// pass has a player pass their turn, as the event loop runs it
+func pass(m *Match, playerNum int) {
+	m.processPass(m.players[playerNum-1], playerNum)
+}
+
+// checkEnding verifies how a match ended from its history record. An empty
+// reason means the match must still be going; winner "" with a reason is a draw.
+func checkEnding(t *testing.T, m *Match, winner, reason string) {
+	t.Helper()
+	record := lastRecord(t, m.server, "alice")
+	if reason == "" {
+		if !m.state.IsGameActive {
+			t.Error("the match ended")
+		}
+		if record != nil {
+			t.Errorf("a match still going was recorded as over (%s)", record.Reason)
+		}
+		return
+	}
+
+	if m.state.IsGameActive {
+		t.Fatal("the match is still going")
+	}
+	if record == nil {
+		t.Fatal("the match wasn't recorded")
+	}
+	if record.Reason != reason {
+		t.Errorf("end reason = %q, want %q", record.Reason, reason)
+	}
+	if record.Winner != winner || record.Draw != (winner == "") {
+		t.Errorf("winner = %q (draw %v), want %q", record.Winner, record.Draw, winner)
+	}
+}
+
+// gameOver returns the game over event a JSON client received
+func gameOver(t *testing.T, conn *recordConn) GameOverMessage {
+	t.Helper()
+	for _, line := range strings.Split(conn.output(), "\n") {
+		var message struct {
+			Type    string          `json:"type"`
+			Content json.RawMessage `json:"content"`
+		}
+		if json.Unmarshal([]byte(line), &message) != nil || message.Type != MsgGameOver {
+			continue
+		}
+		var event GameOverMessage
+		if err := json.Unmarshal(message.Content, &event); err != nil {
+			t.Fatal(err)
+		}
+		return event
+	}
+	t.Fatal("no game over event was sent")
+	return GameOverMessage{}
+}
+
+// queued reports whether the client is waiting in the matchmaking queue
+func queued(s *Server, client *Client) bool {
+	s.matchmaker.mux.Lock()
+	defer s.matchmaker.mux.Unlock()
+
+	for _, entry := range s.matchmaker.queue {
+		if entry.client == client {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRegisterMatchRefusesBusyClients(t *testing.T) {
+	s := newTestServer(t, "alice", "bob", "carol")
+	alice, _ := newTestClient(s, "alice")
+	bob, _ := newTestClient(s, "bob")
+	carol, _ := newTestClient(s, "carol")
+
+	first := s.registerMatch(alice, bob, ModeTurnBased)
+	if first == nil {
+		t.Fatal("registerMatch() refused two idle clients")
+	}
+	if match := s.registerMatch(carol, bob, ModeTurnBased); match != nil {
+		t.Error("registerMatch() put bob into a second match")
+	}
+	if match, _ := carol.Match(); match != nil {
+		t.Error("carol was attached to the refused match")
+	}
+
+	// Once the first match is over both are free again
+	first.finish()
+	if match := s.registerMatch(carol, bob, ModeTurnBased); match == nil {
+		t.Error("registerMatch() refused a client whose match had finished")
+	}
+}
+
+// TestPracticeDuringPairing covers a player starting practice after the
+// matchmaker paired them but before their ranked match was registered
+func TestPracticeDuringPairing(t *testing.T) {
+	tests := []struct {
+		name         string
+		practiceWins bool // practice registers before the ranked match does
+	}{
+		{"ranked match registers first", false},
+		{"practice registers first", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, "alice", "bob")
+			alice, aliceConn := newTestClient(s, "alice")
+			bob, bobConn := newTestClient(s, "bob")
+
+			s.joinQueue(alice, ModeTurnBased)
+			s.joinQueue(bob, ModeTurnBased)
+			pairs := s.matchmaker.findPairs()
+			if len(pairs) != 1 {
+				t.Fatalf("findPairs() = %d pairs, want 1", len(pairs))
+			}
+
+			if tt.practiceWins {
+				// The pairing check passed just before the matchmaker took alice
+				practice := s.registerMatch(alice, newBot(BotEasy, s.loadPlayerData("alice"), s.templates).client, ModeTurnBased)
+				if practice == nil {
+					t.Fatal("practice match refused")
+				}
+				practice.practice = true
+
+				if match := s.startMatch(alice, bob, ModeTurnBased); match != nil {
+					t.Fatal("startMatch() paired a player who is in a practice match")
+				}
+				if match, _ := bob.Match(); match != nil {
+					t.Error("bob was attached to the abandoned ranked match")
+				}
+				if !queued(s, bob) {
+					t.Error("bob was not put back in the queue")
+				}
+				if !strings.Contains(bobConn.output(), "no longer available") {
+					t.Error("bob wasn't told why they are back in the queue")
+				}
+				if queued(s, alice) {
+					t.Error("alice was queued while in practice")
+				}
+				return
+			}
+
+			s.startPractice(alice, BotEasy, ModeTurnBased)
+			if !strings.Contains(aliceConn.output(), "An opponent was just found") {
+				t.Errorf("practice was not refused while paired, alice saw:\n%s", aliceConn.output())
+			}
+			match := s.startMatch(alice, bob, ModeTurnBased)
+			if match == nil {
+				t.Fatal("startMatch() failed")
+			}
+			defer match.finish()
+			if !match.ranked {
+				t.Error("the queued match isn't ranked")
+			}
+			aliceMatch, _ := alice.Match()
+			bobMatch, _ := bob.Match()
+			if aliceMatch != match || bobMatch != match {
+				t.Error("players are not both in the ranked match")
+			}
+
+			// Practice is refused once the ranked match exists
+			s.handlePracticeCommand(alice, nil)
+			if !strings.Contains(aliceConn.output(), "already in a match") {
+				t.Error("practice was not refused during the ranked match")
+			}
+		})
+	}
+}
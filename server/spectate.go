@@ -0,0 +1,275 @@
+// spectate.go
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Spectating returns the live match the client is watching, or nil
+func (c *Client) Spectating() *Match {
+	c.matchMux.RLock()
+	match := c.spectating
+	c.matchMux.RUnlock()
+
+	if match == nil || !match.isActive() {
+		return nil
+	}
+	return match
+}
+
+// setSpectating records the match the client watches (nil to stop)
+func (c *Client) setSpectating(match *Match) {
+	c.matchMux.Lock()
+	defer c.matchMux.Unlock()
+
+	c.spectating = match
+}
+
+// addSpectator attaches a read-only observer to the match
+func (m *Match) addSpectator(client *Client) {
+	m.spectatorsMux.Lock()
+	defer m.spectatorsMux.Unlock()
+
+	m.spectators[client] = true
+}
+
+// removeSpectator detaches an observer; it reports whether the client was watching
+func (m *Match) removeSpectator(client *Client) bool {
+	m.spectatorsMux.Lock()
+	defer m.spectatorsMux.Unlock()
+
+	if !m.spectators[client] {
+		return false
+	}
+	delete(m.spectators, client)
+	return true
+}
+
+// spectatorCount returns how many observers are watching
+func (m *Match) spectatorCount() int {
+	m.spectatorsMux.Lock()
+	defer m.spectatorsMux.Unlock()
+
+	return len(m.spectators)
+}
+
+// broadcastToSpectators sends an event to every observer of the match
+func (m *Match) broadcastToSpectators(msgType string, content interface{}, text string) {
+	m.spectatorsMux.Lock()
+	defer m.spectatorsMux.Unlock()
+
+	for client := range m.spectators {
+		client.SendEvent(msgType, content, text)
+	}
+}
+
+// stopSpectating detaches the client from whatever match it watches
+func (s *Server) stopSpectating(client *Client) bool {
+	client.matchMux.RLock()
+	match := client.spectating
+	client.matchMux.RUnlock()
+	if match == nil {
+		return false
+	}
+
+	client.setSpectating(nil)
+	if !match.removeSpectator(client) {
+		return false
+	}
+	match.stateMux.RLock()
+	defer match.stateMux.RUnlock()
+	if match.state != nil && match.state.IsGameActive {
+		match.broadcastEvent(MsgSpectate, SpectateMessage{
+			MatchID:    match.ID,
+			Username:   client.Username,
+			Spectators: match.spectatorCount(),
+		}, fmt.Sprintf("👀 %s stopped spectating.\n", client.Username))
+	}
+	return true
+}
+
+// handleSpectateCommand processes "spectate", "spectate <match>" and "spectate stop"
+func (s *Server) handleSpectateCommand(client *Client, args []string) {
+	if len(args) == 0 {
+		s.listLiveMatches(client)
+		return
+	}
+
+	if args[0] == "stop" {
+		if s.stopSpectating(client) {
+			client.Send("⏹️ You stopped spectating.\n")
+		} else {
+			client.SendError("❌ You are not spectating a match.\n")
+		}
+		return
+	}
+
+	if match, _ := client.Match(); match != nil && match.isActive() {
+		client.SendError("❌ You can't spectate while playing a match.\n")
+		return
+	}
+
+	id := strings.TrimPrefix(args[0], "#")
+	s.matchesMux.RLock()
+	match := s.matches[id]
+	s.matchesMux.RUnlock()
+	if match == nil || !match.isActive() {
+		client.SendError(fmt.Sprintf("❌ No live match #%s. Type 'spectate' to list live matches.\n", id))
+		return
+	}
+	if current := client.Spectating(); current == match {
+		client.SendError(fmt.Sprintf("❌ You are already spectating match #%s.\n", id))
+		return
+	}
+
+	s.stopSpectating(client)
+	log.Printf("Match #%s: %s is spectating", match.ID, client.Username)
+
+	// Announce before attaching so the new spectator isn't told about themselves
+	match.stateMux.RLock()
+	match.broadcastEvent(MsgSpectate, SpectateMessage{
+		MatchID:    match.ID,
+		Username:   client.Username,
+		Joined:     true,
+		Spectators: match.spectatorCount() + 1,
+	}, fmt.Sprintf("👀 %s is now spectating.\n", client.Username))
+	match.stateMux.RUnlock()
+	client.setSpectating(match)
+	match.addSpectator(client)
+	client.Send(fmt.Sprintf("👀 Spectating match #%s. Type 'status' for the board and 'spectate stop' to leave.\n", match.ID))
+	match.displaySpectatorState(client)
+}
+
+// listLiveMatches shows the matches that can be spectated
+func (s *Server) listLiveMatches(client *Client) {
+	matches := s.runningMatches()
+	sort.Slice(matches, func(i, j int) bool {
+		a, _ := strconv.Atoi(matches[i].ID)
+		b, _ := strconv.Atoi(matches[j].ID)
+		return a < b
+	})
+
+	entries := make([]LiveMatchEntry, 0, len(matches))
+	output := "👀 Live matches:\n"
+	for _, match := range matches {
+		match.stateMux.RLock()
+		if match.state != nil && match.state.IsGameActive {
+			entry := LiveMatchEntry{
+				MatchID:    match.ID,
+				Player1:    match.state.Player1.Username,
+				Player2:    match.state.Player2.Username,
+				Mode:       match.mode,
+				Elapsed:    time.Since(match.state.GameStartTime).Seconds(),
+				Spectators: match.spectatorCount(),
+			}
+			entries = append(entries, entry)
+			output += fmt.Sprintf("  #%-4s %s vs %s (%s) - %s played, %d watching\n",
+				entry.MatchID, entry.Player1, entry.Player2, modeName(entry.Mode),
+				formatDuration(entry.Elapsed), entry.Spectators)
+		}
+		match.stateMux.RUnlock()
+	}
+	output += "💡 Use: spectate <id>\n"
+	if len(entries) == 0 {
+		output = "👀 No live matches right now.\n"
+	}
+	client.SendEvent(MsgLiveMatches, LiveMatchesMessage{Matches: entries}, output)
+}
+
+// displaySpectatorState shows both sides of the board to an observer
+func (m *Match) displaySpectatorState(c *Client) {
+	m.stateMux.RLock()
+	defer m.stateMux.RUnlock()
+
+	if m.state == nil {
+		c.SendError("❌ Game not started yet.\n")
+		return
+	}
+
+	p1, p2 := m.state.Player1, m.state.Player2
+	output := fmt.Sprintf("\n╔═════════════ 👀 SPECTATING #%s ═════════════╗\n", m.ID)
+
+	var turnStatus string
+	if m.mode == ModeRealTime {
+		turnStatus = "⚡ REAL-TIME - both players attack freely"
+	} else if m.state.Turn == 1 {
+		turnStatus = fmt.Sprintf("🔄 %s's TURN", p1.Username)
+	} else {
+		turnStatus = fmt.Sprintf("🔄 %s's TURN", p2.Username)
+	}
+	output += fmt.Sprintf("║ Turn: %-45s ║\n", turnStatus)
+	turnTimeLeft := 0
+	if m.hasTurnClock() && m.state.IsGameActive {
+		turnTimeLeft = m.turnLeft
+		output += fmt.Sprintf("║ ⏱️ Turn clock: %-33s ║\n", fmt.Sprintf("%d seconds left", m.turnLeft))
+	}
+
+	remaining := 0.0
+	if m.state.IsGameActive {
+		remaining = math.Max(0, float64(m.state.GameDuration)-time.Since(m.state.GameStartTime).Seconds())
+		if remaining > 0 {
+			output += fmt.Sprintf("║ ⏰ Time Remaining: %-27.0f seconds ║\n", remaining)
+		} else {
+			output += fmt.Sprintf("║ ⏰ Time: %-39s ║\n", "OVERTIME!")
+		}
+	}
+
+	manas := []float64{m.state.Player1Mana, m.state.Player2Mana}
+	for i, player := range []*PlayerData{p1, p2} {
+		output += fmt.Sprintf("╠═══════════════════════════════════════════════════╣\n")
+		output += fmt.Sprintf("║ 🧑 %-24s 💧 Mana: %-8.0f/10 ║\n", player.Username, manas[i])
+
+		for _, pos := range towerPositions {
+			tower := player.Towers[pos]
+			if tower == nil {
+				continue
+			}
+			status := "🟢 ALIVE"
+			if tower.HP <= 0 {
+				status = "💥 DESTROYED"
+			} else if tower.Shield > 0 {
+				status = fmt.Sprintf("🛡️ %.0f", tower.Shield)
+			}
+			hpPercent := (tower.HP / tower.MaxHP) * 100
+			output += fmt.Sprintf("║ %-12s (%s): HP %4.0f/%4.0f (%3.0f%%) [%s] ║\n",
+				tower.Type, pos, tower.HP, tower.MaxHP, hpPercent, status)
+		}
+
+		for slot, troop := range m.deck(i + 1) {
+			output += fmt.Sprintf("║ %d. %-8s: HP %3.0f, ATK %3.0f, DEF %3.0f, MANA %3.0f ║\n",
+				slot+1, troop.Name, troop.HP, troop.ATK, troop.DEF, troop.MANA)
+			if troop.HP <= 0 {
+				output += fmt.Sprintf("║    %-46s ║\n", "💀 Knocked out")
+			}
+		}
+	}
+
+	spectators := m.spectatorCount()
+	output += fmt.Sprintf("╠═══════════════════════════════════════════════════╣\n")
+	output += fmt.Sprintf("║ 👀 Spectators: %-34d ║\n", spectators)
+	output += fmt.Sprintf("╚═══════════════════════════════════════════════════╝\n")
+
+	c.SendEvent(MsgStatus, SpectatorStatusMessage{
+		MatchID:       m.ID,
+		Mode:          m.mode,
+		IsGameActive:  m.state.IsGameActive,
+		Turn:          m.state.Turn,
+		Player1:       p1.Username,
+		Player2:       p2.Username,
+		Player1Mana:   m.state.Player1Mana,
+		Player2Mana:   m.state.Player2Mana,
+		TimeRemaining: remaining,
+		TurnTimeLeft:  turnTimeLeft,
+		Player1Towers: p1.Towers,
+		Player2Towers: p2.Towers,
+		Player1Troops: m.deck(1),
+		Player2Troops: m.deck(2),
+		Spectators:    spectators,
+	}, output)
+}
@@ -0,0 +1,257 @@
+// templates.go
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	templatesFile         = "game_templates.json"
+	templatesPollInterval = 2 * time.Second // how often the file is checked for changes
+	maxMana               = 10              // mana cap, and the highest cost a troop may have
+)
+
+// Tower types every template file must define
+var requiredTowers = []string{"King Tower", "Guard Tower"}
+
+// loadGameTemplates reads, migrates and validates the templates file
+func loadGameTemplates() (*GameTemplates, error) {
+	data, err := migrateFile(templatesFile, templateMigrations)
+	if err != nil {
+		return nil, err
+	}
+
+	var templates GameTemplates
+	if err := json.Unmarshal(data, &templates); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", templatesFile, err)
+	}
+	if err := validateTemplates(&templates); err != nil {
+		return nil, err
+	}
+	return &templates, nil
+}
+
+// validateTemplates checks balance data for values the game can't run with.
+// Every problem found is reported, not just the first.
+func validateTemplates(t *GameTemplates) error {
+	var problems []string
+	fail := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if len(t.Troops) < deckSize {
+		fail("at least %d troops are needed to build a deck (found %d)", deckSize, len(t.Troops))
+	}
+	troopNames := make(map[string]bool)
+	for i, troop := range t.Troops {
+		name := troop.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+			fail("troop %s has no name", name)
+		} else if strings.ContainsAny(name, " \t") {
+			fail("troop %s: name can't contain spaces", name)
+		}
+		key := strings.ToLower(troop.Name)
+		if troop.Name != "" && troopNames[key] {
+			fail("troop %s is defined more than once", name)
+		}
+		troopNames[key] = true
+
+		if troop.HP <= 0 {
+			fail("troop %s: hp must be positive (is %g)", name, troop.HP)
+		}
+		if troop.ATK < 0 || troop.DEF < 0 || troop.EXP < 0 {
+			fail("troop %s: atk, def and exp can't be negative", name)
+		}
+		if troop.MANA < 1 || troop.MANA > maxMana {
+			fail("troop %s: mana cost must be between 1 and %d (is %g)", name, maxMana, troop.MANA)
+		}
+		if troop.CRIT < 0 || troop.CRIT > 1 {
+			fail("troop %s: crit must be between 0 and 1 (is %g)", name, troop.CRIT)
+		}
+		if troop.CritMultiplier < 0 {
+			fail("troop %s: crit_multiplier can't be negative", name)
+		}
+		for _, ability := range troop.Abilities {
+			if err := validateAbility(ability); err != nil {
+				fail("troop %s: %v", name, err)
+			}
+		}
+		if troop.ATK <= 0 && len(troop.Abilities) == 0 {
+			fail("troop %s: a troop without atk needs at least one ability", name)
+		}
+	}
+
+	towerTypes := make(map[string]bool)
+	for i, tower := range t.Towers {
+		name := tower.Type
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+			fail("tower %s has no type", name)
+		}
+		if tower.Type != "" && towerTypes[tower.Type] {
+			fail("tower %s is defined more than once", name)
+		}
+		towerTypes[tower.Type] = true
+
+		if tower.HP <= 0 {
+			fail("tower %s: hp must be positive (is %g)", name, tower.HP)
+		}
+		if tower.ATK < 0 || tower.DEF < 0 || tower.EXP < 0 {
+			fail("tower %s: atk, def and exp can't be negative", name)
+		}
+		if tower.CRIT < 0 || tower.CRIT > 1 {
+			fail("tower %s: crit must be between 0 and 1 (is %g)", name, tower.CRIT)
+		}
+		if tower.CritMultiplier < 0 {
+			fail("tower %s: crit_multiplier can't be negative", name)
+		}
+	}
+	for _, required := range requiredTowers {
+		if !towerTypes[required] {
+			fail("tower %s is missing", required)
+		}
+	}
+
+	if _, err := newDamageModel(t.Damage); err != nil {
+		fail("damage: %v", err)
+	}
+	if rules := t.Rules; rules.TurnSeconds < 0 || (rules.TurnSeconds > 0 && rules.TurnSeconds < minTurnSeconds) {
+		fail("rules: turn_seconds must be 0 (off) or at least %d (is %d)", minTurnSeconds, rules.TurnSeconds)
+	}
+	if t.Rules.MaxTurnTimeouts < 0 {
+		fail("rules: max_turn_timeouts can't be negative (is %d)", t.Rules.MaxTurnTimeouts)
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid templates:\n  - " + strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+// currentTemplates returns the templates in effect. The value is never
+// modified; a reload swaps in a new one.
+func (s *Server) currentTemplates() *GameTemplates {
+	s.templatesMux.RLock()
+	defer s.templatesMux.RUnlock()
+	return s.templates
+}
+
+// reloadTemplates loads the templates file and puts it into effect for new
+// matches. An invalid file is rejected and the previous templates are kept.
+func (s *Server) reloadTemplates() error {
+	info, err := os.Stat(templatesFile)
+	if err != nil {
+		return err
+	}
+
+	templates, err := loadGameTemplates()
+
+	s.templatesMux.Lock()
+	defer s.templatesMux.Unlock()
+	// Remember the rejected version too, so the watcher doesn't retry it every poll.
+	// A migration rewrites the file, so stat it again.
+	if migrated, statErr := os.Stat(templatesFile); statErr == nil {
+		info = migrated
+	}
+	s.templatesModTime = info.ModTime()
+	if err != nil {
+		return err
+	}
+
+	s.templates = templates
+	log.Printf("Loaded %s: %d troops, %d towers", templatesFile, len(templates.Troops), len(templates.Towers))
+	return nil
+}
+
+// watchTemplates reloads the templates whenever the file changes on disk
+func (s *Server) watchTemplates() {
+	ticker := time.NewTicker(templatesPollInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		info, err := os.Stat(templatesFile)
+		if err != nil {
+			continue
+		}
+		s.templatesMux.RLock()
+		changed := !info.ModTime().Equal(s.templatesModTime)
+		s.templatesMux.RUnlock()
+		if !changed {
+			continue
+		}
+
+		log.Printf("%s changed on disk, reloading", templatesFile)
+		if err := s.reloadTemplates(); err != nil {
+			log.Printf("Keeping the previous templates: %v", err)
+		}
+	}
+}
+
+// isAdmin reports whether a user may run admin commands
+func (s *Server) isAdmin(username string) bool {
+	return s.admins[strings.ToLower(username)]
+}
+
+// handleReloadCommand lets an admin reload the templates without a restart
+func (s *Server) handleReloadCommand(client *Client) {
+	if !s.isAdmin(client.Username) {
+		client.SendError("❌ Only admins can reload the game templates.\n")
+		return
+	}
+
+	if err := s.reloadTemplates(); err != nil {
+		log.Printf("%s's template reload rejected: %v", client.Username, err)
+		client.SendError(fmt.Sprintf("❌ Templates not reloaded, the previous version stays in effect.\n%v\n", err))
+		return
+	}
+
+	templates := s.currentTemplates()
+	log.Printf("%s reloaded the game templates", client.Username)
+	client.Send(fmt.Sprintf("✅ Reloaded %d troops and %d towers. Changes apply from the next match.\n",
+		len(templates.Troops), len(templates.Towers)))
+}
+
+// levelScale is the stat multiplier of a unit at the given level
+func levelScale(level int) float64 {
+	return math.Pow(unitLevelStatBoost, float64(max(level, 1)-1))
+}
+
+// applyTemplates rebuilds a player's unit stats from the templates, scaled by
+// each unit's level, so balance changes reach existing accounts. Units whose
+// template was removed keep their stored stats.
+func applyTemplates(player *PlayerData, templates *GameTemplates) {
+	for _, troop := range player.Troops {
+		template := templates.troop(troop.Name)
+		if template == nil {
+			continue
+		}
+		scale := levelScale(troop.Level)
+		troop.MaxHP = template.HP * scale
+		troop.HP = troop.MaxHP
+		troop.ATK = template.ATK * scale
+		troop.DEF = template.DEF * scale
+		troop.MANA = template.MANA
+		troop.Special = template.description()
+	}
+
+	for _, tower := range player.Towers {
+		template := templates.tower(tower.Type)
+		if template == nil {
+			continue
+		}
+		scale := levelScale(tower.Level)
+		tower.MaxHP = template.HP * scale
+		tower.HP = tower.MaxHP
+		tower.ATK = template.ATK * scale
+		tower.DEF = template.DEF * scale
+		tower.CRIT = template.CRIT
+	}
+}
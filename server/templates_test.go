@@ -0,0 +1,156 @@
+// templates_test.go
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateTemplates(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(t *GameTemplates)
+		want   []string // substrings the error must contain; none for valid templates
+	}{
+		{
+			name:   "defaults are valid",
+			modify: func(t *GameTemplates) {},
+		},
+		{
+			name:   "turn clock on",
+			modify: func(t *GameTemplates) { t.Rules = RulesConfig{TurnSeconds: 30, MaxTurnTimeouts: 3} },
+		},
+		{
+			name:   "too few troops for a deck",
+			modify: func(t *GameTemplates) { t.Troops = t.Troops[:deckSize-1] },
+			want:   []string{"troops are needed to build a deck"},
+		},
+		{
+			name:   "troop without a name",
+			modify: func(t *GameTemplates) { t.Troops[1].Name = "" },
+			want:   []string{"troop #2 has no name"},
+		},
+		{
+			name:   "troop name with a space",
+			modify: func(t *GameTemplates) { t.Troops[0].Name = "Big Pawn" },
+			want:   []string{"name can't contain spaces"},
+		},
+		{
+			name:   "duplicate troop, ignoring case",
+			modify: func(t *GameTemplates) { t.Troops[1].Name = "pawn" },
+			want:   []string{"troop pawn is defined more than once"},
+		},
+		{
+			name:   "troop without hp",
+			modify: func(t *GameTemplates) { t.Troops[0].HP = 0 },
+			want:   []string{"troop Pawn: hp must be positive"},
+		},
+		{
+			name:   "negative troop stats",
+			modify: func(t *GameTemplates) { t.Troops[0].DEF = -1 },
+			want:   []string{"troop Pawn: atk, def and exp can't be negative"},
+		},
+		{
+			name:   "free troop",
+			modify: func(t *GameTemplates) { t.Troops[0].MANA = 0 },
+			want:   []string{"troop Pawn: mana cost must be between 1 and 10"},
+		},
+		{
+			name:   "troop costing more than the mana cap",
+			modify: func(t *GameTemplates) { t.Troops[0].MANA = maxMana + 1 },
+			want:   []string{"mana cost must be between"},
+		},
+		{
+			name:   "troop crit above 1",
+			modify: func(t *GameTemplates) { t.Troops[0].CRIT = 1.5 },
+			want:   []string{"troop Pawn: crit must be between 0 and 1"},
+		},
+		{
+			name:   "negative troop crit multiplier",
+			modify: func(t *GameTemplates) { t.Troops[0].CritMultiplier = -2 },
+			want:   []string{"troop Pawn: crit_multiplier can't be negative"},
+		},
+		{
+			name:   "unknown ability",
+			modify: func(t *GameTemplates) { t.Troops[5].Abilities = []Ability{{Effect: "teleport"}} },
+			want:   []string{`troop Queen: unknown effect "teleport"`},
+		},
+		{
+			name:   "ability with bad parameters",
+			modify: func(t *GameTemplates) { t.Troops[5].Abilities = []Ability{{Effect: EffectDOT, Amount: 10}} },
+			want:   []string{"troop Queen: dot: duration must be at least 1 second"},
+		},
+		{
+			name:   "support troop without abilities",
+			modify: func(t *GameTemplates) { t.Troops[5].Abilities = nil },
+			want:   []string{"troop Queen: a troop without atk needs at least one ability"},
+		},
+		{
+			name:   "missing tower",
+			modify: func(t *GameTemplates) { t.Towers = t.Towers[:1] },
+			want:   []string{"tower Guard Tower is missing"},
+		},
+		{
+			name:   "duplicate tower",
+			modify: func(t *GameTemplates) { t.Towers = append(t.Towers, t.Towers[0]) },
+			want:   []string{"tower King Tower is defined more than once"},
+		},
+		{
+			name:   "tower without a type",
+			modify: func(t *GameTemplates) { t.Towers = append(t.Towers, TowerTemplate{HP: 100}) },
+			want:   []string{"tower #3 has no type"},
+		},
+		{
+			name:   "bad tower stats",
+			modify: func(t *GameTemplates) { t.Towers[0].HP = -5; t.Towers[0].CRIT = 2 },
+			want:   []string{"tower King Tower: hp must be positive", "tower King Tower: crit must be between 0 and 1"},
+		},
+		{
+			name:   "unknown damage formula",
+			modify: func(t *GameTemplates) { t.Damage.Formula = "quadratic" },
+			want:   []string{`damage: unknown damage formula "quadratic"`},
+		},
+		{
+			name:   "turn clock too short",
+			modify: func(t *GameTemplates) { t.Rules.TurnSeconds = minTurnSeconds - 1 },
+			want:   []string{"rules: turn_seconds must be 0 (off) or at least"},
+		},
+		{
+			name:   "negative timeout limit",
+			modify: func(t *GameTemplates) { t.Rules.MaxTurnTimeouts = -1 },
+			want:   []string{"rules: max_turn_timeouts can't be negative"},
+		},
+		{
+			name: "every problem is reported",
+			modify: func(t *GameTemplates) {
+				t.Troops[0].HP = 0
+				t.Troops[1].MANA = 0
+				t.Towers = t.Towers[1:]
+			},
+			want: []string{"troop Pawn: hp", "troop Bishop: mana", "tower King Tower is missing"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			templates := defaultGameTemplates()
+			tt.modify(templates)
+
+			err := validateTemplates(templates)
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("validateTemplates() error = %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("validateTemplates() accepted invalid templates")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q doesn't mention %q", err, want)
+				}
+			}
+		})
+	}
+}
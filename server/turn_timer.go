@@ -0,0 +1,86 @@
+// turn_timer.go
+package main
+
+import (
+	"fmt"
+)
+
+const minTurnSeconds = 5 // shortest turn clock the templates may set
+
+// turnWarnings are the seconds left at which the player on turn is warned
+var turnWarnings = []int{10, 5}
+
+// RulesConfig holds match rules that aren't unit balance
+type RulesConfig struct {
+	TurnSeconds     int `json:"turn_seconds"`      // turn clock in turn-based mode; 0 disables it
+	MaxTurnTimeouts int `json:"max_turn_timeouts"` // consecutive timeouts that forfeit the match; 0 never forfeits
+}
+
+// hasTurnClock reports whether turns in this match are timed
+func (m *Match) hasTurnClock() bool {
+	return m.mode == ModeTurnBased && m.templates.Rules.TurnSeconds > 0
+}
+
+// resetTurnClock gives the player on turn a full clock. Caller must hold stateMux.
+func (m *Match) resetTurnClock() {
+	if m.hasTurnClock() {
+		m.turnLeft = m.templates.Rules.TurnSeconds
+	}
+}
+
+// tickTurnClock runs the turn clock down by one second, warning the player on
+// turn and passing the turn when it runs out. It is driven by the recorded
+// ticks, so replays time out at the same moments. Caller must hold stateMux.
+func (m *Match) tickTurnClock() {
+	if !m.hasTurnClock() || !m.state.IsGameActive {
+		return
+	}
+
+	m.turnLeft--
+	idx := m.state.Turn - 1
+	current := m.state.Player1.Username
+	if m.state.Turn == 2 {
+		current = m.state.Player2.Username
+	}
+
+	if m.turnLeft > 0 {
+		for _, warning := range turnWarnings {
+			if m.turnLeft != warning {
+				continue
+			}
+			event := TurnTimerMessage{Username: current, SecondsLeft: m.turnLeft}
+			if player := m.players[idx]; player != nil {
+				player.SendEvent(MsgTurnTimer, event, fmt.Sprintf("⏳ %d seconds left in your turn!\n", m.turnLeft))
+			}
+			m.broadcastEventToOthers(m.players[idx], MsgTurnTimer, event,
+				fmt.Sprintf("⏳ %s has %d seconds left to move.\n", current, m.turnLeft))
+			m.broadcastToSpectators(MsgTurnTimer, event,
+				fmt.Sprintf("⏳ %s has %d seconds left to move.\n", current, m.turnLeft))
+		}
+		return
+	}
+
+	m.turnTimeouts[idx]++
+	timeouts, limit := m.turnTimeouts[idx], m.templates.Rules.MaxTurnTimeouts
+	if limit > 0 && timeouts >= limit {
+		winner := m.state.Player2.Username
+		if m.state.Turn == 2 {
+			winner = m.state.Player1.Username
+		}
+		m.endGame(3-m.state.Turn, EndIdle, fmt.Sprintf("💤 %s ran out of time %d turns in a row. %s wins by forfeit!",
+			current, timeouts, winner))
+		return
+	}
+
+	text := fmt.Sprintf("⌛ %s ran out of time and the turn passes.", current)
+	if limit > 0 {
+		text += fmt.Sprintf(" (%d/%d before forfeit)", timeouts, limit)
+	}
+	m.broadcastEvent(MsgTurnTimer, TurnTimerMessage{
+		Username:    current,
+		TimedOut:    true,
+		Timeouts:    timeouts,
+		MaxTimeouts: limit,
+	}, text+"\n")
+	m.switchTurn()
+}
@@ -0,0 +1,118 @@
+// turn_timer_test.go
+package main
+
+import "testing"
+
+func TestTurnClock(t *testing.T) {
+	clock := RulesConfig{TurnSeconds: 5, MaxTurnTimeouts: 2}
+
+	tests := []struct {
+		name         string
+		mode         string
+		rules        RulesConfig
+		script       func(m *Match)
+		wantTurn     int
+		wantTimeouts [2]int
+		wantWinner   string // empty while the match goes on
+		wantReason   string
+	}{
+		{
+			name:     "warnings don't pass the turn",
+			rules:    clock,
+			script:   func(m *Match) { tick(m, 4) },
+			wantTurn: 1,
+		},
+		{
+			name:         "an idle turn passes",
+			rules:        clock,
+			script:       func(m *Match) { tick(m, 5) },
+			wantTurn:     2,
+			wantTimeouts: [2]int{1, 0},
+		},
+		{
+			name:         "the next player gets a full clock",
+			rules:        clock,
+			script:       func(m *Match) { tick(m, 10) },
+			wantTurn:     1,
+			wantTimeouts: [2]int{1, 1},
+		},
+		{
+			name:  "a move resets the player's run of timeouts",
+			rules: clock,
+			script: func(m *Match) {
+				tick(m, 5)
+				pass(m, 2)
+				pass(m, 1)
+				tick(m, 10)
+			},
+			wantTurn:     2,
+			wantTimeouts: [2]int{1, 1},
+		},
+		{
+			name:  "player 1 forfeits after too many timeouts",
+			rules: clock,
+			script: func(m *Match) {
+				tick(m, 5)
+				pass(m, 2)
+				tick(m, 5)
+			},
+			wantTurn:     1,
+			wantTimeouts: [2]int{2, 0},
+			wantWinner:   "bob",
+			wantReason:   EndIdle,
+		},
+		{
+			name:  "player 2 forfeits after too many timeouts",
+			rules: clock,
+			script: func(m *Match) {
+				pass(m, 1)
+				tick(m, 5)
+				pass(m, 1)
+				tick(m, 5)
+			},
+			wantTurn:     2,
+			wantTimeouts: [2]int{0, 2},
+			wantWinner:   "alice",
+			wantReason:   EndIdle,
+		},
+		{
+			name:         "no limit never forfeits",
+			rules:        RulesConfig{TurnSeconds: 5},
+			script:       func(m *Match) { tick(m, 50) },
+			wantTurn:     1,
+			wantTimeouts: [2]int{5, 5},
+		},
+		{
+			name:     "clock off",
+			script:   func(m *Match) { tick(m, 60) },
+			wantTurn: 1,
+		},
+		{
+			name:     "real-time matches have no turn clock",
+			mode:     ModeRealTime,
+			rules:    clock,
+			script:   func(m *Match) { tick(m, 60) },
+			wantTurn: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestMatch(t)
+			if tt.mode != "" {
+				m.mode, m.state.Mode = tt.mode, tt.mode
+			}
+			m.templates.Rules = tt.rules
+			m.resetTurnClock()
+
+			tt.script(m)
+			if m.state.Turn != tt.wantTurn {
+				t.Errorf("turn = %d, want %d", m.state.Turn, tt.wantTurn)
+			}
+			if m.turnTimeouts != tt.wantTimeouts {
+				t.Errorf("timeouts = %v, want %v", m.turnTimeouts, tt.wantTimeouts)
+			}
+			checkEnding(t, m, tt.wantWinner, tt.wantReason)
+		})
+	}
+}